@@ -1,21 +1,33 @@
 package main
 
 import (
+    "bytes"
+    "encoding/binary"
     "encoding/json"
     "fmt"
     "image"
     "image/color"
+    "image/gif"
     "image/jpeg"
-    _ "image/png"
+    "image/png"
+    "io"
     "math"
+    "math/rand"
     "os"
+    "path/filepath"
     "strconv"
+    "strings"
     "sync"
+    "sync/atomic"
     "sort"
 )
 
 type ConfigColors struct {
     Colors []string
+    // Luminance holds each Colors[i]'s WCAG relative luminance, in the same order. Only
+    // populated by modes that compute luminance (e.g. "luminance-asc"/"luminance-desc");
+    // omitted from the saved JSON otherwise.
+    Luminance []float64 `json:",omitempty"`
 }
 
 type ColorPair struct {
@@ -86,12 +98,229 @@ Example:
     c := GetClosestColor(toMatch, colors);
 */
 func GetClosestColor(c color.Color, l []color.Color) color.Color {
-    var mDistance uint32 = 0xFFFFFFFF;
+    return GetClosestColorWithMetric(c, l, SRGBEuclideanMetric{});
+}
+
+/*
+A ColorMetric scores the perceptual distance between two colors. Lower is closer.
+*/
+type ColorMetric interface {
+    Distance(c1 color.Color, c2 color.Color) float64
+}
+
+/*
+SRGBEuclideanMetric is the plain Euclidean distance between raw sRGB channels, as used
+historically by GetColorDistance.
+*/
+type SRGBEuclideanMetric struct{}
+
+func (m SRGBEuclideanMetric) Distance(c1 color.Color, c2 color.Color) float64 {
+    return float64(GetColorDistance(c1, c2));
+}
+
+/*
+LumaWeightedMetric weights each channel by its contribution to perceived brightness
+(ITU-R BT.601 luma coefficients) before taking the Euclidean distance, so green
+differences count most and blue differences least.
+*/
+type LumaWeightedMetric struct{}
+
+func (m LumaWeightedMetric) Distance(c1 color.Color, c2 color.Color) float64 {
+    r1, g1, b1, _ := c1.RGBA();
+    r2, g2, b2, _ := c2.RGBA();
+
+    dr := float64(AbsDiff(r2, r1)) * 0.299;
+    dg := float64(AbsDiff(g2, g1)) * 0.587;
+    db := float64(AbsDiff(b2, b1)) * 0.114;
+
+    return math.Sqrt(dr*dr + dg*dg + db*db);
+}
+
+/*
+CIELabMetric converts both colors from sRGB to CIE Lab (via linear RGB and XYZ) and
+returns the Euclidean distance between them (ΔE76), which tracks human perception far
+more closely than raw channel differences.
+*/
+type CIELabMetric struct{}
+
+func (m CIELabMetric) Distance(c1 color.Color, c2 color.Color) float64 {
+    l1, a1, b1 := colorToLab(c1);
+    l2, a2, b2 := colorToLab(c2);
+
+    dl := l2 - l1;
+    da := a2 - a1;
+    db := b2 - b1;
+
+    return math.Sqrt(dl*dl + da*da + db*db);
+}
+
+/*
+Converts a single sRGB channel value in [0, 1] to linear light.
+
+Arguments:
+    - c (float64): The sRGB channel value, in [0, 1].
+
+Returns:
+    - float64: The linear channel value.
+*/
+func srgbChannelToLinear(c float64) float64 {
+    if c <= 0.04045 {
+        return c / 12.92;
+    }
+    return math.Pow((c+0.055)/1.055, 2.4);
+}
+
+/*
+Converts a color.Color to CIE Lab coordinates (D65 white point).
+
+Arguments:
+    - c (color.Color): The color to convert.
+
+Returns:
+    - float64: The L component.
+    - float64: The a component.
+    - float64: The b component.
+*/
+func colorToLab(c color.Color) (float64, float64, float64) {
+    r, g, b, _ := c.RGBA();
+
+    rl := srgbChannelToLinear(float64(r) / 0xFFFF);
+    gl := srgbChannelToLinear(float64(g) / 0xFFFF);
+    bl := srgbChannelToLinear(float64(b) / 0xFFFF);
+
+    x := (rl*0.4124564 + gl*0.3575761 + bl*0.1804375) / 0.95047;
+    y := (rl*0.2126729 + gl*0.7151522 + bl*0.0721750) / 1.00000;
+    z := (rl*0.0193339 + gl*0.1191920 + bl*0.9503041) / 1.08883;
+
+    fx := labF(x);
+    fy := labF(y);
+    fz := labF(z);
+
+    l := 116*fy - 16;
+    a := 500 * (fx - fy);
+    bb := 200 * (fy - fz);
+
+    return l, a, bb;
+}
+
+/*
+Applies the CIE Lab forward transfer function used to turn an XYZ component into the
+corresponding f(t) term shared by L, a and b.
+
+Arguments:
+    - t (float64): The XYZ component, normalized by its white point reference.
+
+Returns:
+    - float64: The transformed component.
+*/
+func labF(t float64) float64 {
+    const delta = 6.0 / 29.0;
+    if t > delta*delta*delta {
+        return math.Cbrt(t);
+    }
+    return t/(3*delta*delta) + 4.0/29.0;
+}
+
+/*
+Applies the inverse of the CIE Lab forward transfer function, turning an f(t) term
+back into an XYZ component normalized by its white point reference.
+
+Arguments:
+    - t (float64): The f(t) term.
+
+Returns:
+    - float64: The XYZ component.
+*/
+func labFInv(t float64) float64 {
+    const delta = 6.0 / 29.0;
+    if t > delta {
+        return t * t * t;
+    }
+    return 3 * delta * delta * (t - 4.0/29.0);
+}
+
+/*
+Converts a linear-light channel value in [0, 1] to sRGB gamma space.
+
+Arguments:
+    - c (float64): The linear channel value.
+
+Returns:
+    - float64: The sRGB channel value, in [0, 1].
+*/
+func linearToSRGBChannel(c float64) float64 {
+    if c <= 0.0031308 {
+        return c * 12.92;
+    }
+    return 1.055*math.Pow(c, 1.0/2.4) - 0.055;
+}
+
+/*
+Converts CIE Lab coordinates (D65 white point) back to a color.Color.
+
+Arguments:
+    - l (float64): The L component.
+    - a (float64): The a component.
+    - b (float64): The b component.
+
+Returns:
+    - color.Color: The corresponding sRGB color.
+*/
+func labToColor(l float64, a float64, b float64) color.Color {
+    fy := (l + 16) / 116;
+    fx := fy + a/500;
+    fz := fy - b/200;
+
+    x := labFInv(fx) * 0.95047;
+    y := labFInv(fy) * 1.00000;
+    z := labFInv(fz) * 1.08883;
+
+    rl := x*3.2404542 + y*-1.5371385 + z*-0.4985314;
+    gl := x*-0.9692660 + y*1.8760108 + z*0.0415560;
+    bl := x*0.0556434 + y*-0.2040259 + z*1.0572252;
+
+    r := linearToSRGBChannel(rl);
+    g := linearToSRGBChannel(gl);
+    bch := linearToSRGBChannel(bl);
+
+    return color.NRGBA{
+        R: clampChannel(r),
+        G: clampChannel(g),
+        B: clampChannel(bch),
+        A: 0xFF,
+    };
+}
+
+/*
+Clamps a [0, 1] channel value and converts it to a uint8 in [0, 255].
+*/
+func clampChannel(c float64) uint8 {
+    v := math.Round(clampFloat(c*255, 0, 255));
+    return uint8(v);
+}
+
+/*
+Gets the closest color matching given color against a list of colors, using the given
+ColorMetric to score distance.
+
+Arguments:
+    - c (color.Color): The color to match.
+    - l ([]color.Color): This list of colors to match against.
+    - m (ColorMetric): The metric to score candidate colors with.
+
+Returns
+    - color.Color: The closest color.
+
+Example:
+    c := GetClosestColorWithMetric(toMatch, colors, CIELabMetric{});
+*/
+func GetClosestColorWithMetric(c color.Color, l []color.Color, m ColorMetric) color.Color {
+    mDistance := math.MaxFloat64;
     index := 0;
 
     for i := 0; i < len(l); i++ {
-        distance := GetColorDistance(c, l[i]);
-        if  distance < mDistance {
+        distance := m.Distance(c, l[i]);
+        if distance < mDistance {
             mDistance = distance;
             index = i;
         }
@@ -117,6 +346,10 @@ Example:
     }
 */
 func LoadImage(p string) (image.Image, error) {
+    if strings.ToLower(filepath.Ext(p)) == ".webp" {
+        return nil, fmt.Errorf("Error: Cannot decode %s: webp decoding is not supported (no WebP codec is registered); convert it to png/jpeg/bmp/tiff/gif first", p);
+    }
+
     f, err := os.Open(p);
     if err != nil {
         return nil, fmt.Errorf("Error: Could not open image %s. %w", p, err);
@@ -126,10 +359,231 @@ func LoadImage(p string) (image.Image, error) {
     if err != nil {
         return nil, fmt.Errorf("Error: Failed to decode image %s. %w", p, err);
     }
+    f.Close();
+
+    if strings.HasSuffix(strings.ToLower(p), ".jpg") || strings.HasSuffix(strings.ToLower(p), ".jpeg") {
+        orientation, err := readJPEGOrientation(p);
+        if err == nil && orientation > 1 {
+            i = applyOrientation(i, orientation);
+        }
+    }
 
     return i, nil;
 }
 
+/*
+Reads the EXIF orientation tag (0x0112) from a JPEG file, if present.
+
+Arguments:
+    - p (string): The filepath to the JPEG image.
+
+Returns:
+    - int: The orientation value (1-8), or 1 if no Exif/orientation tag is found.
+    - error: An error if the file could not be read.
+*/
+func readJPEGOrientation(p string) (int, error) {
+    f, err := os.Open(p);
+    if err != nil {
+        return 1, fmt.Errorf("Error: Could not open image %s. %w", p, err);
+    }
+    defer f.Close();
+
+    header := make([]byte, 2);
+    if _, err := f.Read(header); err != nil || header[0] != 0xFF || header[1] != 0xD8 {
+        return 1, nil;
+    }
+
+    for {
+        marker := make([]byte, 2);
+        if _, err := f.Read(marker); err != nil {
+            return 1, nil;
+        }
+        if marker[0] != 0xFF {
+            return 1, nil;
+        }
+
+        lenBuf := make([]byte, 2);
+        if _, err := f.Read(lenBuf); err != nil {
+            return 1, nil;
+        }
+        segmentLen := int(binary.BigEndian.Uint16(lenBuf));
+        if segmentLen < 2 {
+            return 1, nil;
+        }
+
+        if marker[1] != 0xE1 {
+            if _, err := f.Seek(int64(segmentLen-2), 1); err != nil {
+                return 1, nil;
+            }
+            continue;
+        }
+
+        segment := make([]byte, segmentLen-2);
+        if _, err := f.Read(segment); err != nil {
+            return 1, nil;
+        }
+
+        return parseExifOrientation(segment), nil;
+    }
+}
+
+/*
+Parses the orientation tag out of a raw Exif (APP1) segment.
+
+Arguments:
+    - segment ([]byte): The raw APP1 segment, starting with the "Exif\0\0" marker.
+
+Returns:
+    - int: The orientation value (1-8), or 1 if no orientation tag is found.
+*/
+func parseExifOrientation(segment []byte) int {
+    if len(segment) < 8 || string(segment[0:4]) != "Exif" {
+        return 1;
+    }
+
+    tiff := segment[6:];
+    if len(tiff) < 8 {
+        return 1;
+    }
+
+    var order binary.ByteOrder;
+    if string(tiff[0:2]) == "II" {
+        order = binary.LittleEndian;
+    } else if string(tiff[0:2]) == "MM" {
+        order = binary.BigEndian;
+    } else {
+        return 1;
+    }
+
+    ifdOffset := order.Uint32(tiff[4:8]);
+    if int(ifdOffset)+2 > len(tiff) {
+        return 1;
+    }
+
+    entryCount := int(order.Uint16(tiff[ifdOffset : ifdOffset+2]));
+    for i := 0; i < entryCount; i++ {
+        entryOffset := int(ifdOffset) + 2 + (i * 12);
+        if entryOffset+12 > len(tiff) {
+            break;
+        }
+
+        tag := order.Uint16(tiff[entryOffset : entryOffset+2]);
+        if tag == 0x0112 {
+            value := order.Uint16(tiff[entryOffset+8 : entryOffset+10]);
+            if value >= 1 && value <= 8 {
+                return int(value);
+            }
+            return 1;
+        }
+    }
+
+    return 1;
+}
+
+/*
+Rotates/flips an image to undo the given EXIF orientation, so the pixels end up
+right-side up regardless of how the camera held the sensor.
+
+Arguments:
+    - img (image.Image): The source image, as decoded.
+    - orientation (int): The EXIF orientation value (1-8).
+
+Returns:
+    - image.Image: The corrected image.
+*/
+func applyOrientation(img image.Image, orientation int) image.Image {
+    bounds := img.Bounds();
+    width := bounds.Dx();
+    height := bounds.Dy();
+
+    switch orientation {
+    case 2:
+        return flipImage(img, true, false);
+    case 3:
+        return rotateImage180(img);
+    case 4:
+        return flipImage(img, false, true);
+    case 5:
+        return flipImage(rotateImage90(img, width, height), true, false);
+    case 6:
+        return rotateImage90(img, width, height);
+    case 7:
+        return flipImage(rotateImage270(img, width, height), true, false);
+    case 8:
+        return rotateImage270(img, width, height);
+    default:
+        return img;
+    }
+}
+
+/*
+Rotates an image 90 degrees clockwise.
+*/
+func rotateImage90(img image.Image, width int, height int) image.Image {
+    result := image.NewNRGBA(image.Rect(0, 0, height, width));
+    for y := 0; y < height; y++ {
+        for x := 0; x < width; x++ {
+            result.Set(height-1-y, x, img.At(img.Bounds().Min.X+x, img.Bounds().Min.Y+y));
+        }
+    }
+    return result;
+}
+
+/*
+Rotates an image 270 degrees clockwise (90 degrees counter-clockwise).
+*/
+func rotateImage270(img image.Image, width int, height int) image.Image {
+    result := image.NewNRGBA(image.Rect(0, 0, height, width));
+    for y := 0; y < height; y++ {
+        for x := 0; x < width; x++ {
+            result.Set(y, width-1-x, img.At(img.Bounds().Min.X+x, img.Bounds().Min.Y+y));
+        }
+    }
+    return result;
+}
+
+/*
+Rotates an image 180 degrees.
+*/
+func rotateImage180(img image.Image) image.Image {
+    bounds := img.Bounds();
+    width := bounds.Dx();
+    height := bounds.Dy();
+
+    result := image.NewNRGBA(image.Rect(0, 0, width, height));
+    for y := 0; y < height; y++ {
+        for x := 0; x < width; x++ {
+            result.Set(width-1-x, height-1-y, img.At(bounds.Min.X+x, bounds.Min.Y+y));
+        }
+    }
+    return result;
+}
+
+/*
+Flips an image horizontally and/or vertically.
+*/
+func flipImage(img image.Image, horizontal bool, vertical bool) image.Image {
+    bounds := img.Bounds();
+    width := bounds.Dx();
+    height := bounds.Dy();
+
+    result := image.NewNRGBA(image.Rect(0, 0, width, height));
+    for y := 0; y < height; y++ {
+        for x := 0; x < width; x++ {
+            dx := x;
+            dy := y;
+            if horizontal {
+                dx = width - 1 - x;
+            }
+            if vertical {
+                dy = height - 1 - y;
+            }
+            result.Set(dx, dy, img.At(bounds.Min.X+x, bounds.Min.Y+y));
+        }
+    }
+    return result;
+}
+
 /*
 Returns a matrix of pixels from an image.
 
@@ -165,168 +619,1898 @@ func LoadPixels(pic image.Image) [][]color.Color {
 }
 
 /*
-Create a new image with colors matching the given pallete.
-
-Arguments:
-    - p ([][]color.Color): The image to be converted.
-    - c ([]color.Color): The pallete to convert to.
+Tile is a rectangular region of an image along with its pixels, in row-major order.
+*/
+type Tile struct {
+    Bounds image.Rectangle
+    Pixels []color.Color
+}
 
-Returns:
-    - image.Image: The converted image.
+/*
+Returns the smaller of two ints.
 */
-func ConvertImage(p [][]color.Color, c []color.Color) image.Image {
-    result := image.NewNRGBA(
-        image.Rectangle{
-            Min: image.Point{X: 0, Y: 0},
-            Max: image.Point{X: len(p[0]), Y: len(p)},
-        },
-    );
+func minInt(a int, b int) int {
+    if a < b {
+        return a;
+    }
+    return b;
+}
 
-    var wg sync.WaitGroup;
-    wg.Add(len(p));
+/*
+Splits an image into tileSize x tileSize tiles (the final row/column may be smaller)
+and streams them over a channel, so a caller never has to hold the whole image's pixel
+matrix in memory at once.
 
-    var mutex sync.RWMutex;
-    colorCache := make(map[color.Color]color.Color);
-    for i := 0; i < len(p); i++ {
-        go func(row int) {
-            defer wg.Done();
-            for j := 0; j < len(p[row]); j++ {
-                mutex.RLock();
-                cachedValue := colorCache[p[row][j]];
-                mutex.RUnlock();
-                if cachedValue != nil {
-                    r, g, b, a := cachedValue.RGBA();
-                    result.Pix[(row * result.Stride) + (j * 4)] = uint8(r);
-                    result.Pix[(row * result.Stride) + (j * 4) + 1] = uint8(g);
-                    result.Pix[row * result.Stride + (j * 4) + 2] = uint8(b);
-                    result.Pix[row * result.Stride + (j * 4) + 3] = uint8(a);
-                } else {
-                    closestColor := GetClosestColor(p[row][j], c);
-                    r, g, b, a := closestColor.RGBA();
-                    result.Pix[(row * result.Stride) + (j * 4)] = uint8(r);
-                    result.Pix[(row * result.Stride) + (j * 4) + 1] = uint8(g);
-                    result.Pix[(row * result.Stride) + (j * 4) + 2] = uint8(b);
-                    result.Pix[(row * result.Stride) + (j * 4) + 3] = uint8(a);
+Arguments:
+    - img (image.Image): The image to tile.
+    - tileSize (int): The width/height of each square tile.
 
-                    mutex.Lock();
-                    if colorCache[p[row][j]] == nil {
-                        colorCache[p[row][j]] = closestColor;
+Returns:
+    - <-chan Tile: A channel of tiles, closed once every tile has been sent.
+
+Example:
+    for tile := range TilesOf(img, 256) {
+        process(tile);
+    }
+*/
+func TilesOf(img image.Image, tileSize int) <-chan Tile {
+    bounds := img.Bounds();
+    ch := make(chan Tile);
+
+    go func() {
+        defer close(ch);
+        for y := bounds.Min.Y; y < bounds.Max.Y; y += tileSize {
+            for x := bounds.Min.X; x < bounds.Max.X; x += tileSize {
+                tileBounds := image.Rect(x, y, minInt(x+tileSize, bounds.Max.X), minInt(y+tileSize, bounds.Max.Y));
+
+                pixels := make([]color.Color, tileBounds.Dx()*tileBounds.Dy());
+                idx := 0;
+                for ty := tileBounds.Min.Y; ty < tileBounds.Max.Y; ty++ {
+                    for tx := tileBounds.Min.X; tx < tileBounds.Max.X; tx++ {
+                        pixels[idx] = img.At(tx, ty);
+                        idx++;
                     }
-                    mutex.Unlock();
                 }
+
+                ch <- Tile{Bounds: tileBounds, Pixels: pixels};
             }
-        }(i);
+        }
+    }();
+
+    return ch;
+}
+
+/*
+Returns how many tiles TilesOf would produce for the given bounds and tile size.
+*/
+func tileCount(bounds image.Rectangle, tileSize int) int {
+    cols := (bounds.Dx() + tileSize - 1) / tileSize;
+    rows := (bounds.Dy() + tileSize - 1) / tileSize;
+    return cols * rows;
+}
+
+/*
+Converter performs tiled, palette-matched conversion with bounded memory: only the
+tiles in flight are held as []color.Color, and the output is written directly into
+a single shared *image.NRGBA at each tile's offset.
+*/
+type Converter struct {
+    Palette []color.Color
+    Metric  ColorMetric
+    // Dither enables Floyd-Steinberg error-diffusion dithering. Dithering propagates
+    // each pixel's quantization error to its neighbors, which makes rows depend on one
+    // another, so Convert falls back to the serial, whole-image dithered pass instead
+    // of tiling across Workers when this is set.
+    Dither  bool
+    Workers int
+    // Progress, if set, is called after each tile completes with the number of tiles
+    // done so far and the total tile count. Not called when Dither is set, since that
+    // path does not tile.
+    Progress func(done int, total int)
+}
+
+/*
+Builds a Converter from a palette and the metric/dithering selected by ConvertOptions,
+defaulting to a single worker.
+
+Arguments:
+    - palette ([]color.Color): The palette to match pixels against.
+    - opts (ConvertOptions): Supplies the ColorMetric and Dither setting to use.
+
+Returns:
+    - *Converter: The new converter.
+*/
+func NewConverter(palette []color.Color, opts ConvertOptions) *Converter {
+    metric := opts.Metric;
+    if metric == nil {
+        metric = SRGBEuclideanMetric{};
+    }
+
+    return &Converter{Palette: palette, Metric: metric, Dither: opts.Dither, Workers: 1};
+}
+
+/*
+Converts an image to the converter's palette by streaming it through tileSize x
+tileSize tiles across Workers goroutines. Each worker keeps its own local color cache
+(rather than sharing one behind a mutex) to avoid cache-lock contention, at the cost of
+redundant lookups across workers.
+
+If Dither is set, tiling and worker parallelism are skipped entirely: Floyd-Steinberg
+error diffusion requires each row's quantization error to feed into the next, so this
+falls back to the same serial whole-image pass ConvertImage uses when dithering, at the
+cost of the tiled path's bounded memory.
+
+Arguments:
+    - img (image.Image): The image to convert.
+    - tileSize (int): The width/height of each square tile.
+
+Returns:
+    - image.Image: The converted image.
+*/
+func (conv *Converter) Convert(img image.Image, tileSize int) image.Image {
+    if conv.Dither {
+        return convertImageDithered(LoadPixels(img), conv.Palette, conv.Metric);
+    }
+
+    bounds := img.Bounds();
+    result := image.NewNRGBA(image.Rect(0, 0, bounds.Dx(), bounds.Dy()));
+
+    workers := conv.Workers;
+    if workers < 1 {
+        workers = 1;
+    }
+
+    total := tileCount(bounds, tileSize);
+    var done int32;
+
+    tiles := TilesOf(img, tileSize);
+
+    var wg sync.WaitGroup;
+    wg.Add(workers);
+    for w := 0; w < workers; w++ {
+        go func() {
+            defer wg.Done();
+            localCache := make(map[color.Color]color.Color);
+
+            for tile := range tiles {
+                tileWidth := tile.Bounds.Dx();
+                for idx, px := range tile.Pixels {
+                    tx := tile.Bounds.Min.X + (idx % tileWidth);
+                    ty := tile.Bounds.Min.Y + (idx / tileWidth);
+
+                    matched, ok := localCache[px];
+                    if !ok {
+                        matched = GetClosestColorWithMetric(px, conv.Palette, conv.Metric);
+                        localCache[px] = matched;
+                    }
+
+                    r, g, b, a := matched.RGBA();
+                    offset := ((ty - bounds.Min.Y) * result.Stride) + ((tx - bounds.Min.X) * 4);
+                    result.Pix[offset] = uint8(r);
+                    result.Pix[offset+1] = uint8(g);
+                    result.Pix[offset+2] = uint8(b);
+                    result.Pix[offset+3] = uint8(a);
+                }
+
+                if conv.Progress != nil {
+                    conv.Progress(int(atomic.AddInt32(&done, 1)), total);
+                }
+            }
+        }();
+    }
+    wg.Wait();
+
+    return result;
+}
+
+/*
+ConvertOptions controls how ConvertImage matches pixels against a palette.
+*/
+type ConvertOptions struct {
+    // Metric scores perceptual distance between two colors. Defaults to SRGBEuclideanMetric{}.
+    Metric ColorMetric
+    // Dither enables Floyd-Steinberg error-diffusion dithering. Dithering makes each
+    // row depend on the quantization error of the previous one, so the converter falls
+    // back to a serial, row-by-row pass instead of the parallel cached path.
+    Dither bool
+}
+
+/*
+Returns a ConvertOptions with the repo's defaults: sRGB Euclidean matching, no dithering.
+
+Returns:
+    - ConvertOptions: The default options.
+*/
+func DefaultConvertOptions() ConvertOptions {
+    return ConvertOptions{Metric: SRGBEuclideanMetric{}};
+}
+
+/*
+ResizeOptions controls how ResizeImage scales an image before further processing.
+*/
+type ResizeOptions struct {
+    // MaxWidth/MaxHeight bound the output dimensions. In "contain"/"cover" fit modes
+    // aspect ratio is preserved; in "stretch" both are used exactly.
+    MaxWidth  int
+    MaxHeight int
+    // Fit is one of "contain" (fit entirely within bounds), "cover" (fill bounds,
+    // cropping overflow) or "stretch" (ignore aspect ratio). Defaults to "contain".
+    Fit string
+    // Kernel is one of "nearest", "bilinear" or "lanczos3". Defaults to "bilinear".
+    Kernel string
+}
+
+/*
+Resizes an image according to the given options.
+
+Arguments:
+    - img (image.Image): The image to resize.
+    - opts (ResizeOptions): The target dimensions, fit mode and interpolation kernel.
+
+Returns:
+    - image.Image: The resized image.
+
+Example:
+    r := ResizeImage(i, ResizeOptions{MaxWidth: 1920, MaxHeight: 1080, Fit: "contain", Kernel: "lanczos3"});
+*/
+func ResizeImage(img image.Image, opts ResizeOptions) image.Image {
+    if opts.Fit == "" {
+        opts.Fit = "contain";
+    }
+    if opts.Kernel == "" {
+        opts.Kernel = "bilinear";
+    }
+
+    bounds := img.Bounds();
+    srcW := bounds.Dx();
+    srcH := bounds.Dy();
+
+    dstW, dstH := targetDimensions(srcW, srcH, opts);
+    if dstW <= 0 || dstH <= 0 {
+        return img;
+    }
+    if dstW == srcW && dstH == srcH {
+        if opts.Fit == "cover" && opts.MaxWidth > 0 && opts.MaxHeight > 0 {
+            return cropCenter(img, opts.MaxWidth, opts.MaxHeight);
+        }
+        return img;
+    }
+
+    var resampled image.Image;
+    switch opts.Kernel {
+    case "nearest":
+        resampled = resampleImage(img, dstW, dstH, nearestKernel, 0);
+    case "lanczos3":
+        resampled = resampleImage(img, dstW, dstH, lanczos3Kernel, 3);
+    default:
+        resampled = resampleImage(img, dstW, dstH, bilinearKernel, 1);
+    }
+
+    if opts.Fit == "cover" {
+        return cropCenter(resampled, opts.MaxWidth, opts.MaxHeight);
+    }
+    return resampled;
+}
+
+/*
+Crops an image to w x h around its center, clamping if the image is already smaller
+than the requested size in a dimension. Used after the cover-scale in ResizeImage so
+"cover" actually fills the requested bounds exactly instead of leaving overflow.
+
+Arguments:
+    - img (image.Image): The image to crop.
+    - w (int): The output width.
+    - h (int): The output height.
+
+Returns:
+    - image.Image: The cropped image.
+*/
+func cropCenter(img image.Image, w int, h int) image.Image {
+    bounds := img.Bounds();
+    w = minInt(w, bounds.Dx());
+    h = minInt(h, bounds.Dy());
+
+    x0 := bounds.Min.X + (bounds.Dx()-w)/2;
+    y0 := bounds.Min.Y + (bounds.Dy()-h)/2;
+
+    result := image.NewNRGBA(image.Rect(0, 0, w, h));
+    for y := 0; y < h; y++ {
+        for x := 0; x < w; x++ {
+            result.Set(x, y, img.At(x0+x, y0+y));
+        }
+    }
+    return result;
+}
+
+/*
+Computes the output dimensions for ResizeImage given the source size and fit mode.
+*/
+func targetDimensions(srcW int, srcH int, opts ResizeOptions) (int, int) {
+    if opts.Fit == "stretch" {
+        return opts.MaxWidth, opts.MaxHeight;
+    }
+
+    if opts.MaxWidth <= 0 || opts.MaxHeight <= 0 {
+        return srcW, srcH;
+    }
+
+    scaleW := float64(opts.MaxWidth) / float64(srcW);
+    scaleH := float64(opts.MaxHeight) / float64(srcH);
+
+    var scale float64;
+    if opts.Fit == "cover" {
+        scale = math.Max(scaleW, scaleH);
+    } else {
+        scale = math.Min(scaleW, scaleH);
+    }
+
+    return int(math.Round(float64(srcW) * scale)), int(math.Round(float64(srcH) * scale));
+}
+
+/*
+A resampleKernel weights samples within `support` pixels of a fractional coordinate.
+*/
+type resampleKernel func(x float64) float64
+
+func nearestKernel(x float64) float64 {
+    if x > -0.5 && x <= 0.5 {
+        return 1;
+    }
+    return 0;
+}
+
+func bilinearKernel(x float64) float64 {
+    x = math.Abs(x);
+    if x < 1 {
+        return 1 - x;
+    }
+    return 0;
+}
+
+func lanczos3Kernel(x float64) float64 {
+    if x == 0 {
+        return 1;
+    }
+    ax := math.Abs(x);
+    if ax >= 3 {
+        return 0;
+    }
+    piX := math.Pi * x;
+    return 3 * math.Sin(piX) * math.Sin(piX/3) / (piX * piX);
+}
+
+/*
+Resamples an image to the given dimensions using a separable kernel, first along X
+then along Y.
+*/
+func resampleImage(img image.Image, dstW int, dstH int, kernel resampleKernel, support float64) image.Image {
+    bounds := img.Bounds();
+    srcW := bounds.Dx();
+    srcH := bounds.Dy();
+
+    if support == 0 {
+        support = 0.5;
+    }
+
+    horizontal := image.NewNRGBA(image.Rect(0, 0, dstW, srcH));
+    scaleX := float64(srcW) / float64(dstW);
+    for dx := 0; dx < dstW; dx++ {
+        srcX := (float64(dx) + 0.5) * scaleX;
+        for y := 0; y < srcH; y++ {
+            r, g, b, a := sampleAxis(img, srcX, y, true, srcW, kernel, support);
+            horizontal.Set(dx, y, color.NRGBA{R: r, G: g, B: b, A: a});
+        }
+    }
+
+    result := image.NewNRGBA(image.Rect(0, 0, dstW, dstH));
+    scaleY := float64(srcH) / float64(dstH);
+    for dy := 0; dy < dstH; dy++ {
+        srcY := (float64(dy) + 0.5) * scaleY;
+        for x := 0; x < dstW; x++ {
+            r, g, b, a := sampleAxis(horizontal, srcY, x, false, srcH, kernel, support);
+            result.Set(x, dy, color.NRGBA{R: r, G: g, B: b, A: a});
+        }
+    }
+
+    return result;
+}
+
+/*
+Samples a single output pixel along one axis, weighting the nearby source pixels by
+the kernel's response.
+*/
+func sampleAxis(img image.Image, srcPos float64, fixed int, horizontalAxis bool, srcLen int, kernel resampleKernel, support float64) (uint8, uint8, uint8, uint8) {
+    lo := int(math.Floor(srcPos - support));
+    hi := int(math.Ceil(srcPos + support));
+
+    var rSum, gSum, bSum, aSum, wSum float64;
+    for i := lo; i <= hi; i++ {
+        weight := kernel(srcPos - (float64(i) + 0.5));
+        if weight == 0 {
+            continue;
+        }
+
+        clamped := i;
+        if clamped < 0 {
+            clamped = 0;
+        } else if clamped >= srcLen {
+            clamped = srcLen - 1;
+        }
+
+        var r, g, b, a uint32;
+        if horizontalAxis {
+            r, g, b, a = img.At(clamped, fixed).RGBA();
+        } else {
+            r, g, b, a = img.At(fixed, clamped).RGBA();
+        }
+
+        rSum += float64(r) * weight;
+        gSum += float64(g) * weight;
+        bSum += float64(b) * weight;
+        aSum += float64(a) * weight;
+        wSum += weight;
+    }
+
+    if wSum == 0 {
+        return 0, 0, 0, 0;
+    }
+
+    // img.At(...).RGBA() returns alpha-premultiplied channels, so the weighted sums
+    // above are premultiplied too. Averaging premultiplied values is correct, but the
+    // result must be unpremultiplied before it can be written into a straight-alpha
+    // color.NRGBA, or partially-transparent pixels come out darkened toward black.
+    aAvg := aSum / wSum;
+    if aAvg <= 0 {
+        return 0, 0, 0, 0;
+    }
+
+    return uint8(clampFloat((rSum/wSum)*0xFFFF/aAvg, 0, 0xFFFF) / 257),
+        uint8(clampFloat((gSum/wSum)*0xFFFF/aAvg, 0, 0xFFFF) / 257),
+        uint8(clampFloat((bSum/wSum)*0xFFFF/aAvg, 0, 0xFFFF) / 257),
+        uint8(clampFloat(aAvg, 0, 0xFFFF) / 257);
+}
+
+/*
+Create a new image with colors matching the given pallete.
+
+Arguments:
+    - p ([][]color.Color): The image to be converted.
+    - c ([]color.Color): The pallete to convert to.
+    - opts (ConvertOptions): The metric/dithering options to convert with.
+
+Returns:
+    - image.Image: The converted image.
+*/
+func ConvertImage(p [][]color.Color, c []color.Color, opts ConvertOptions) image.Image {
+    if opts.Metric == nil {
+        opts.Metric = SRGBEuclideanMetric{};
+    }
+
+    if opts.Dither {
+        return convertImageDithered(p, c, opts.Metric);
+    }
+
+    result := image.NewNRGBA(
+        image.Rectangle{
+            Min: image.Point{X: 0, Y: 0},
+            Max: image.Point{X: len(p[0]), Y: len(p)},
+        },
+    );
+
+    var wg sync.WaitGroup;
+    wg.Add(len(p));
+
+    var mutex sync.RWMutex;
+    colorCache := make(map[color.Color]color.Color);
+    for i := 0; i < len(p); i++ {
+        go func(row int) {
+            defer wg.Done();
+            for j := 0; j < len(p[row]); j++ {
+                mutex.RLock();
+                cachedValue := colorCache[p[row][j]];
+                mutex.RUnlock();
+                if cachedValue != nil {
+                    r, g, b, a := cachedValue.RGBA();
+                    result.Pix[(row * result.Stride) + (j * 4)] = uint8(r);
+                    result.Pix[(row * result.Stride) + (j * 4) + 1] = uint8(g);
+                    result.Pix[row * result.Stride + (j * 4) + 2] = uint8(b);
+                    result.Pix[row * result.Stride + (j * 4) + 3] = uint8(a);
+                } else {
+                    closestColor := GetClosestColorWithMetric(p[row][j], c, opts.Metric);
+                    r, g, b, a := closestColor.RGBA();
+                    result.Pix[(row * result.Stride) + (j * 4)] = uint8(r);
+                    result.Pix[(row * result.Stride) + (j * 4) + 1] = uint8(g);
+                    result.Pix[(row * result.Stride) + (j * 4) + 2] = uint8(b);
+                    result.Pix[(row * result.Stride) + (j * 4) + 3] = uint8(a);
+
+                    mutex.Lock();
+                    if colorCache[p[row][j]] == nil {
+                        colorCache[p[row][j]] = closestColor;
+                    }
+                    mutex.Unlock();
+                }
+            }
+        }(i);
+    }
+
+    wg.Wait();
+    return result;
+}
+
+/*
+Converts an image to the given palette using serial Floyd-Steinberg error-diffusion
+dithering. Quantization residuals are distributed to the right, bottom-left, bottom
+and bottom-right neighbors with weights 7/16, 3/16, 5/16 and 1/16 respectively.
+
+Arguments:
+    - p ([][]color.Color): The image to be converted.
+    - c ([]color.Color): The pallete to convert to.
+    - m (ColorMetric): The metric to match pixels against the palette with.
+
+Returns:
+    - image.Image: The converted image.
+*/
+func convertImageDithered(p [][]color.Color, c []color.Color, m ColorMetric) image.Image {
+    height := len(p);
+    width := len(p[0]);
+
+    result := image.NewNRGBA(
+        image.Rectangle{
+            Min: image.Point{X: 0, Y: 0},
+            Max: image.Point{X: width, Y: height},
+        },
+    );
+
+    // Working buffer of float RGB so accumulated error isn't clamped until the final write.
+    buf := make([][][3]float64, height);
+    for y := 0; y < height; y++ {
+        buf[y] = make([][3]float64, width);
+        for x := 0; x < width; x++ {
+            r, g, b, _ := p[y][x].RGBA();
+            buf[y][x] = [3]float64{float64(r) / 257, float64(g) / 257, float64(b) / 257};
+        }
+    }
+
+    addError := func(y int, x int, err [3]float64, weight float64) {
+        if y < 0 || y >= height || x < 0 || x >= width {
+            return;
+        }
+        buf[y][x][0] = clampFloat(buf[y][x][0]+err[0]*weight, 0, 255);
+        buf[y][x][1] = clampFloat(buf[y][x][1]+err[1]*weight, 0, 255);
+        buf[y][x][2] = clampFloat(buf[y][x][2]+err[2]*weight, 0, 255);
+    };
+
+    for y := 0; y < height; y++ {
+        for x := 0; x < width; x++ {
+            px := buf[y][x];
+            original := color.NRGBA{
+                R: uint8(px[0]),
+                G: uint8(px[1]),
+                B: uint8(px[2]),
+                A: 0xFF,
+            };
+
+            closestColor := GetClosestColorWithMetric(original, c, m);
+            r, g, b, a := closestColor.RGBA();
+            result.Pix[(y*result.Stride)+(x*4)] = uint8(r);
+            result.Pix[(y*result.Stride)+(x*4)+1] = uint8(g);
+            result.Pix[(y*result.Stride)+(x*4)+2] = uint8(b);
+            result.Pix[(y*result.Stride)+(x*4)+3] = uint8(a);
+
+            errPx := [3]float64{
+                px[0] - float64(uint8(r)),
+                px[1] - float64(uint8(g)),
+                px[2] - float64(uint8(b)),
+            };
+
+            addError(y, x+1, errPx, 7.0/16.0);
+            addError(y+1, x-1, errPx, 3.0/16.0);
+            addError(y+1, x, errPx, 5.0/16.0);
+            addError(y+1, x+1, errPx, 1.0/16.0);
+        }
+    }
+
+    return result;
+}
+
+/*
+Clamps a float64 to the given inclusive range.
+
+Arguments:
+    - v (float64): The value to clamp.
+    - min (float64): The lower bound.
+    - max (float64): The upper bound.
+
+Returns:
+    - float64: The clamped value.
+*/
+func clampFloat(v float64, min float64, max float64) float64 {
+    if v < min {
+        return min;
+    }
+    if v > max {
+        return max;
+    }
+    return v;
+}
+
+func init() {
+    image.RegisterFormat("bmp", "BM", bmpDecode, bmpDecodeConfig);
+    image.RegisterFormat("tiff", "II*\x00", tiffDecode, tiffDecodeConfig);
+    image.RegisterFormat("tiff", "MM\x00*", tiffDecode, tiffDecodeConfig);
+}
+
+/*
+Encodes an image as an uncompressed 24-bit BMP (BITMAPINFOHEADER, bottom-up row order).
+
+Arguments:
+    - w (io.Writer): Where to write the BMP.
+    - img (image.Image): The image to encode.
+
+Returns:
+    - error: An error if encoding fails.
+*/
+func bmpEncode(w io.Writer, img image.Image) error {
+    bounds := img.Bounds();
+    width := bounds.Dx();
+    height := bounds.Dy();
+
+    rowSize := ((width*3 + 3) / 4) * 4;
+    pixelDataSize := rowSize * height;
+    pixelDataOffset := 14 + 40;
+    fileSize := pixelDataOffset + pixelDataSize;
+
+    header := make([]byte, pixelDataOffset);
+    header[0] = 'B';
+    header[1] = 'M';
+    binary.LittleEndian.PutUint32(header[2:6], uint32(fileSize));
+    binary.LittleEndian.PutUint32(header[10:14], uint32(pixelDataOffset));
+
+    binary.LittleEndian.PutUint32(header[14:18], 40);
+    binary.LittleEndian.PutUint32(header[18:22], uint32(width));
+    binary.LittleEndian.PutUint32(header[22:26], uint32(height));
+    binary.LittleEndian.PutUint16(header[26:28], 1);
+    binary.LittleEndian.PutUint16(header[28:30], 24);
+    binary.LittleEndian.PutUint32(header[34:38], uint32(pixelDataSize));
+
+    if _, err := w.Write(header); err != nil {
+        return err;
+    }
+
+    row := make([]byte, rowSize);
+    for y := height - 1; y >= 0; y-- {
+        for x := 0; x < width; x++ {
+            r, g, b, _ := img.At(bounds.Min.X+x, bounds.Min.Y+y).RGBA();
+            row[x*3] = uint8(b >> 8);
+            row[x*3+1] = uint8(g >> 8);
+            row[x*3+2] = uint8(r >> 8);
+        }
+        for i := width * 3; i < rowSize; i++ {
+            row[i] = 0;
+        }
+        if _, err := w.Write(row); err != nil {
+            return err;
+        }
+    }
+
+    return nil;
+}
+
+/*
+Reads a BMP's dimensions without decoding its pixel data.
+*/
+func bmpDecodeConfig(r io.Reader) (image.Config, error) {
+    header := make([]byte, 26);
+    if _, err := io.ReadFull(r, header); err != nil {
+        return image.Config{}, fmt.Errorf("bmp: could not read header: %w", err);
+    }
+    if header[0] != 'B' || header[1] != 'M' {
+        return image.Config{}, fmt.Errorf("bmp: not a BMP file");
+    }
+
+    width := int(int32(binary.LittleEndian.Uint32(header[18:22])));
+    height := int(int32(binary.LittleEndian.Uint32(header[22:26])));
+    if height < 0 {
+        height = -height;
+    }
+
+    return image.Config{ColorModel: color.NRGBAModel, Width: width, Height: height}, nil;
+}
+
+/*
+Decodes an uncompressed 24- or 32-bit BMP.
+
+Arguments:
+    - r (io.Reader): The BMP data to decode.
+
+Returns:
+    - image.Image: The decoded image.
+    - error: An error if the BMP is unsupported or malformed.
+*/
+func bmpDecode(r io.Reader) (image.Image, error) {
+    data, err := io.ReadAll(r);
+    if err != nil {
+        return nil, fmt.Errorf("bmp: could not read file: %w", err);
+    }
+    if len(data) < 54 || data[0] != 'B' || data[1] != 'M' {
+        return nil, fmt.Errorf("bmp: not a BMP file");
+    }
+
+    pixelOffset := binary.LittleEndian.Uint32(data[10:14]);
+    headerSize := binary.LittleEndian.Uint32(data[14:18]);
+    if headerSize < 40 {
+        return nil, fmt.Errorf("bmp: unsupported header size %d", headerSize);
+    }
+
+    width := int(int32(binary.LittleEndian.Uint32(data[18:22])));
+    heightRaw := int32(binary.LittleEndian.Uint32(data[22:26]));
+    bpp := binary.LittleEndian.Uint16(data[28:30]);
+    compression := binary.LittleEndian.Uint32(data[30:34]);
+    if compression != 0 {
+        return nil, fmt.Errorf("bmp: compressed BMPs are not supported");
+    }
+    if bpp != 24 && bpp != 32 {
+        return nil, fmt.Errorf("bmp: unsupported bit depth %d", bpp);
+    }
+
+    topDown := heightRaw < 0;
+    height := int(heightRaw);
+    if height < 0 {
+        height = -height;
+    }
+
+    bytesPerPixel := int(bpp / 8);
+    rowSize := ((width*bytesPerPixel + 3) / 4) * 4;
+
+    img := image.NewNRGBA(image.Rect(0, 0, width, height));
+    for y := 0; y < height; y++ {
+        srcY := y;
+        if !topDown {
+            srcY = height - 1 - y;
+        }
+
+        rowStart := int(pixelOffset) + srcY*rowSize;
+        if rowStart+width*bytesPerPixel > len(data) {
+            return nil, fmt.Errorf("bmp: truncated pixel data");
+        }
+
+        for x := 0; x < width; x++ {
+            off := rowStart + x*bytesPerPixel;
+            a := uint8(0xFF);
+            if bytesPerPixel == 4 && data[off+3] != 0 {
+                a = data[off+3];
+            }
+            img.SetNRGBA(x, y, color.NRGBA{R: data[off+2], G: data[off+1], B: data[off], A: a});
+        }
+    }
+
+    return img, nil;
+}
+
+// tiffTag is a single TIFF IFD entry as written by tiffEncode.
+type tiffTag struct {
+    ID    uint16
+    Type  uint16
+    Count uint32
+    Value uint32
+}
+
+/*
+Encodes an image as a baseline, uncompressed, single-strip, 8-bit-per-sample RGB TIFF
+(little-endian). This covers exactly the subset tiffDecode understands.
+
+Arguments:
+    - w (io.Writer): Where to write the TIFF.
+    - img (image.Image): The image to encode.
+
+Returns:
+    - error: An error if encoding fails.
+*/
+func tiffEncode(w io.Writer, img image.Image) error {
+    bounds := img.Bounds();
+    width := bounds.Dx();
+    height := bounds.Dy();
+
+    const ifdStart = 8;
+    const entryCount = 9;
+    ifdSize := 2 + entryCount*12 + 4;
+    bitsPerSampleOffset := ifdStart + ifdSize;
+    pixelDataOffset := bitsPerSampleOffset + 6;
+    pixelDataSize := width * height * 3;
+
+    tags := []tiffTag{
+        {ID: 256, Type: 4, Count: 1, Value: uint32(width)},
+        {ID: 257, Type: 4, Count: 1, Value: uint32(height)},
+        {ID: 258, Type: 3, Count: 3, Value: uint32(bitsPerSampleOffset)},
+        {ID: 259, Type: 3, Count: 1, Value: 1},
+        {ID: 262, Type: 3, Count: 1, Value: 2},
+        {ID: 273, Type: 4, Count: 1, Value: uint32(pixelDataOffset)},
+        {ID: 277, Type: 3, Count: 1, Value: 3},
+        {ID: 278, Type: 4, Count: 1, Value: uint32(height)},
+        {ID: 279, Type: 4, Count: 1, Value: uint32(pixelDataSize)},
+    };
+
+    var buf bytes.Buffer;
+    buf.WriteString("II");
+    binary.Write(&buf, binary.LittleEndian, uint16(42));
+    binary.Write(&buf, binary.LittleEndian, uint32(ifdStart));
+
+    binary.Write(&buf, binary.LittleEndian, uint16(entryCount));
+    for _, t := range tags {
+        binary.Write(&buf, binary.LittleEndian, t.ID);
+        binary.Write(&buf, binary.LittleEndian, t.Type);
+        binary.Write(&buf, binary.LittleEndian, t.Count);
+        binary.Write(&buf, binary.LittleEndian, t.Value);
+    }
+    binary.Write(&buf, binary.LittleEndian, uint32(0));
+
+    binary.Write(&buf, binary.LittleEndian, uint16(8));
+    binary.Write(&buf, binary.LittleEndian, uint16(8));
+    binary.Write(&buf, binary.LittleEndian, uint16(8));
+
+    pixels := make([]byte, pixelDataSize);
+    idx := 0;
+    for y := 0; y < height; y++ {
+        for x := 0; x < width; x++ {
+            r, g, b, _ := img.At(bounds.Min.X+x, bounds.Min.Y+y).RGBA();
+            pixels[idx] = uint8(r >> 8);
+            pixels[idx+1] = uint8(g >> 8);
+            pixels[idx+2] = uint8(b >> 8);
+            idx += 3;
+        }
+    }
+    buf.Write(pixels);
+
+    _, err := w.Write(buf.Bytes());
+    return err;
+}
+
+/*
+Reads a baseline TIFF's dimensions, as written by tiffEncode, without decoding its
+pixel data.
+*/
+func tiffDecodeConfig(r io.Reader) (image.Config, error) {
+    data, err := io.ReadAll(r);
+    if err != nil {
+        return image.Config{}, fmt.Errorf("tiff: could not read file: %w", err);
+    }
+
+    width, height, _, _, err := parseTIFF(data);
+    if err != nil {
+        return image.Config{}, err;
+    }
+
+    return image.Config{ColorModel: color.NRGBAModel, Width: width, Height: height}, nil;
+}
+
+/*
+Decodes a baseline, uncompressed, single-strip, 8-bit-per-sample RGB TIFF, as written
+by tiffEncode. Other TIFF variants (compressed, tiled, multi-strip, non-RGB) are not
+supported.
+
+Arguments:
+    - r (io.Reader): The TIFF data to decode.
+
+Returns:
+    - image.Image: The decoded image.
+    - error: An error if the TIFF is unsupported or malformed.
+*/
+func tiffDecode(r io.Reader) (image.Image, error) {
+    data, err := io.ReadAll(r);
+    if err != nil {
+        return nil, fmt.Errorf("tiff: could not read file: %w", err);
+    }
+
+    width, height, stripOffset, stripByteCount, err := parseTIFF(data);
+    if err != nil {
+        return nil, err;
+    }
+
+    if stripOffset+stripByteCount > len(data) {
+        return nil, fmt.Errorf("tiff: truncated pixel data");
+    }
+    if stripByteCount < width*height*3 {
+        return nil, fmt.Errorf("tiff: strip too small for %dx%d RGB image", width, height);
+    }
+
+    img := image.NewNRGBA(image.Rect(0, 0, width, height));
+    idx := stripOffset;
+    for y := 0; y < height; y++ {
+        for x := 0; x < width; x++ {
+            img.SetNRGBA(x, y, color.NRGBA{R: data[idx], G: data[idx+1], B: data[idx+2], A: 0xFF});
+            idx += 3;
+        }
+    }
+
+    return img, nil;
+}
+
+/*
+Parses a baseline TIFF's header and first IFD, returning width, height and the single
+strip's offset/length. Only little- and big-endian byte order detection and the tags
+tiffEncode writes (256, 257, 273, 279) are consulted.
+*/
+func parseTIFF(data []byte) (int, int, int, int, error) {
+    if len(data) < 8 {
+        return 0, 0, 0, 0, fmt.Errorf("tiff: file too short");
+    }
+
+    var order binary.ByteOrder;
+    if data[0] == 'I' && data[1] == 'I' {
+        order = binary.LittleEndian;
+    } else if data[0] == 'M' && data[1] == 'M' {
+        order = binary.BigEndian;
+    } else {
+        return 0, 0, 0, 0, fmt.Errorf("tiff: not a TIFF file");
+    }
+
+    ifdOffset := order.Uint32(data[4:8]);
+    if int(ifdOffset)+2 > len(data) {
+        return 0, 0, 0, 0, fmt.Errorf("tiff: IFD offset out of range");
+    }
+
+    entryCount := int(order.Uint16(data[ifdOffset : ifdOffset+2]));
+    var width, height, stripOffset, stripByteCount int;
+
+    for i := 0; i < entryCount; i++ {
+        entryStart := int(ifdOffset) + 2 + (i * 12);
+        if entryStart+12 > len(data) {
+            return 0, 0, 0, 0, fmt.Errorf("tiff: IFD entry out of range");
+        }
+
+        tag := order.Uint16(data[entryStart : entryStart+2]);
+        value := int(order.Uint32(data[entryStart+8 : entryStart+12]));
+
+        switch tag {
+        case 256:
+            width = value;
+        case 257:
+            height = value;
+        case 273:
+            stripOffset = value;
+        case 279:
+            stripByteCount = value;
+        }
+    }
+
+    if width == 0 || height == 0 || stripByteCount == 0 {
+        return 0, 0, 0, 0, fmt.Errorf("tiff: missing required tag(s)");
+    }
+
+    return width, height, stripOffset, stripByteCount, nil;
+}
+
+/*
+SaveOptions controls how SaveImage encodes an image.
+*/
+type SaveOptions struct {
+    // Format overrides the encoder chosen from the file extension. One of "png",
+    // "jpeg", "gif", "bmp" or "tiff". "webp" is recognized from the extension but
+    // always fails to encode; see the "webp" case in SaveImage.
+    Format string
+    // Quality is the JPEG quality, 1-100. Defaults to 90.
+    Quality int
+    // PNGCompression is the PNG compression level. Defaults to png.DefaultCompression.
+    PNGCompression png.CompressionLevel
+    // Palette, if set, is used to write exact-match GIF output: each pixel is mapped
+    // to its palette index directly instead of letting gif.Encode re-quantize with its
+    // own default quantizer, which would discard a palette ConvertImage/Converter
+    // already matched pixels against. Ignored by every other format.
+    Palette []color.Color
+}
+
+/*
+Returns a SaveOptions with the repo's defaults: format inferred from extension, JPEG
+quality 90, default PNG compression.
+
+Returns:
+    - SaveOptions: The default options.
+*/
+func DefaultSaveOptions() SaveOptions {
+    return SaveOptions{Quality: 90, PNGCompression: png.DefaultCompression};
+}
+
+/*
+Infers an encoder name from a file's extension, falling back to "jpeg". Note that
+"webp" is recognized here but SaveImage always fails to encode it; see SaveImage.
+
+Arguments:
+    - p (string): The file path.
+
+Returns:
+    - string: One of "png", "jpeg", "gif", "bmp", "tiff" or "webp".
+*/
+func formatFromExtension(p string) string {
+    switch strings.ToLower(filepath.Ext(p)) {
+    case ".png":
+        return "png";
+    case ".gif":
+        return "gif";
+    case ".bmp":
+        return "bmp";
+    case ".tif", ".tiff":
+        return "tiff";
+    case ".webp":
+        return "webp";
+    default:
+        return "jpeg";
+    }
+}
+
+/*
+Saves an image to a path, choosing an encoder from the file extension unless
+opts.Format overrides it.
+
+WebP is not supported: for the "webp" format SaveImage returns an error without
+encoding anything (the file at p is still created, empty), and LoadImage rejects .webp
+paths. BMP and TIFF are written by the self-contained bmpEncode and tiffEncode above.
+
+Arguments:
+    - p (string): Path to save image.
+    - i (image.Image): Image to save.
+    - opts (SaveOptions): The format/quality options to encode with.
+
+Returns:
+    - error: Error saving the image if any.
+
+Example:
+    err := SaveImage("./test.jpeg", i, DefaultSaveOptions());
+    if err != nil {
+        return err;
+    }
+*/
+func SaveImage(p string, i image.Image, opts SaveOptions) error {
+    f, err := os.Create(p);
+    if err != nil {
+        return fmt.Errorf("Error: Cannot create file %s. %w", p, err);
+    }
+    defer f.Close();
+
+    format := opts.Format;
+    if format == "" {
+        format = formatFromExtension(p);
+    }
+
+    quality := opts.Quality;
+    if quality <= 0 {
+        quality = 90;
+    }
+
+    switch format {
+    case "png":
+        encoder := png.Encoder{CompressionLevel: opts.PNGCompression};
+        err = encoder.Encode(f, i);
+    case "gif":
+        if len(opts.Palette) > 0 {
+            err = gif.Encode(f, paletteMatchedImage(i, opts.Palette), nil);
+        } else {
+            err = gif.Encode(f, i, nil);
+        }
+    case "bmp":
+        err = bmpEncode(f, i);
+    case "tiff":
+        err = tiffEncode(f, i);
+    case "webp":
+        err = fmt.Errorf("webp encoding is not supported: this repo has no vendored WebP codec and this environment has no network access to fetch golang.org/x/image/webp, so .webp is recognized but intentionally unsupported rather than silently producing an invalid file");
+    default:
+        err = jpeg.Encode(f, i, &jpeg.Options{Quality: quality});
+    }
+
+    if err != nil {
+        return fmt.Errorf("Error: Failed to encode image %s. %w", p, err);
+    }
+
+    return nil;
+}
+
+/*
+Builds an *image.Paletted restricted to the given palette, mapping each pixel to its
+nearest palette entry. Used to hand GIF encoding an already-paletted image so
+gif.Encode writes the exact palette instead of re-quantizing through its own default
+quantizer and ditherer.
+
+Arguments:
+    - i (image.Image): The image to remap. Every pixel is expected to already be one
+      of palette's colors (e.g. the output of ConvertImage/Converter), so the mapping
+      is an exact lookup rather than a re-quantization.
+    - palette ([]color.Color): The palette to restrict the image to.
+
+Returns:
+    - *image.Paletted: The palette-matched image.
+*/
+func paletteMatchedImage(i image.Image, palette []color.Color) *image.Paletted {
+    bounds := i.Bounds();
+    pal := make(color.Palette, len(palette));
+    copy(pal, palette);
+
+    result := image.NewPaletted(bounds, pal);
+    cache := make(map[color.Color]uint8);
+    for y := bounds.Min.Y; y < bounds.Max.Y; y++ {
+        for x := bounds.Min.X; x < bounds.Max.X; x++ {
+            px := i.At(x, y);
+            idx, ok := cache[px];
+            if !ok {
+                idx = uint8(pal.Index(px));
+                cache[px] = idx;
+            }
+            result.SetColorIndex(x, y, idx);
+        }
+    }
+
+    return result;
+}
+
+/*
+Saves the exact palette used for a conversion alongside the converted image, as
+"<output path>.pal.json".
+
+Arguments:
+    - outputPath (string): The path the converted image was saved to.
+    - palette ([]color.Color): The palette that was converted to.
+
+Returns:
+    - error: An error if any occured.
+
+Example:
+    err := SavePaletteAlongside("./wall.png", palette);
+    if err != nil {
+        return err;
+    }
+*/
+func SavePaletteAlongside(outputPath string, palette []color.Color) error {
+    return SaveConfg(outputPath+".pal.json", ConfigColors{Colors: colorsToHex(palette)});
+}
+
+/*
+Returns a list of colors from the config file.
+
+Arguments
+    - p (string): The file path to the config file.
+
+Returns:
+    - []color.Color: The list of loaded colors.
+    - error: The error that occured when attempting to load then from the file if any.
+
+Example:
+    c, err := LoadConfig("./config.json");
+    if err != nil {
+        return err;
+    }
+*/
+func LoadConfig(p string) ([]color.Color, error) {
+    f, err := os.Open(p);
+    if err != nil {
+        return nil, fmt.Errorf("Error: Could not open config file %s. %w", p, err);
+    }
+    defer f.Close();
+
+    var v ConfigColors;
+    d := json.NewDecoder(f);
+    err = d.Decode(&v);
+    if err != nil {
+        return nil, fmt.Errorf("Error: Could not parse config file %s. %w", p, err);
+    }
+
+    result := make([]color.Color, len(v.Colors));
+    for i := 0; i < len(v.Colors); i++ {
+        num, err := strconv.ParseUint(v.Colors[i][1:], 16, 32);
+        if err != nil {
+            return nil, fmt.Errorf("Error: Failed to parse color %s. %w", v.Colors[i], err);
+        }
+
+        result[i] = color.NRGBA{
+            R: uint8(num >> 16),
+            G: uint8((num >> 8) & 0xFF),
+            B: uint8(num & 0xFF),
+            A: uint8(0xFF),
+        };
+    }
+
+    return result, nil;
+}
+
+/*
+Save a color scheme to a file.
+
+Arguments:
+    - p (string): The path to save the color scheme to.
+    - c (SaveConfg): The color theme.
+
+Returns:
+    - error: An error if any occured.
+
+Example:
+    err := SaveConfg("./theme.json", c);
+    if err != nil {
+        return err;
+    }
+*/
+func SaveConfg(p string, c ConfigColors) error {
+    f, err := os.Create(p);
+    if err != nil {
+        return fmt.Errorf("Error: Failed to create file %s. %w", p, err);
+    }
+    defer f.Close();
+
+    e := json.NewEncoder(f);
+    err = e.Encode(c);
+    if err != nil {
+        return fmt.Errorf("Error: Failed to write JSON to %s. %w", p, err);
+    }
+
+    return nil;
+}
+
+// PaletteSize is the number of colors GenerateColors emits, capped by the number of
+// unique colors actually present in the image.
+const PaletteSize = 21
+
+const kMeansMaxIterations = 50
+const kMeansEpsilon = 1.0
+
+/*
+labPoint is a unique color reduced to its CIE Lab coordinates, weighted by how many
+pixels in the source image had that exact color.
+*/
+type labPoint struct {
+    L      float64
+    A      float64
+    B      float64
+    Weight int
+    Color  color.Color
+}
+
+/*
+labCentroid is a cluster center in CIE Lab space.
+*/
+type labCentroid struct {
+    L float64
+    A float64
+    B float64
+}
+
+/*
+Converts a ColorPairList (unique colors with pixel counts) into labPoints.
+*/
+func labPointsFromPairs(pairs ColorPairList) []labPoint {
+    points := make([]labPoint, len(pairs));
+    for i, pair := range pairs {
+        l, a, b := colorToLab(pair.Key);
+        points[i] = labPoint{L: l, A: a, B: b, Weight: pair.Value, Color: pair.Key};
+    }
+    return points;
+}
+
+/*
+Finds the centroid nearest to a point, returning its index and squared Lab distance.
+*/
+func nearestCentroid(pt labPoint, centroids []labCentroid) (int, float64) {
+    best := 0;
+    bestDist := math.MaxFloat64;
+    for i, c := range centroids {
+        d := math.Pow(pt.L-c.L, 2) + math.Pow(pt.A-c.A, 2) + math.Pow(pt.B-c.B, 2);
+        if d < bestDist {
+            bestDist = d;
+            best = i;
+        }
+    }
+    return best, bestDist;
+}
+
+/*
+Seeds k centroids by picking k distinct points uniformly at random.
+*/
+func seedCentroidsRandom(points []labPoint, k int) []labCentroid {
+    indices := rand.Perm(len(points))[:k];
+    centroids := make([]labCentroid, k);
+    for i, idx := range indices {
+        centroids[i] = labCentroid{L: points[idx].L, A: points[idx].A, B: points[idx].B};
+    }
+    return centroids;
+}
+
+/*
+Seeds k centroids using k-means++: the first is picked uniformly at random, each
+subsequent one with probability proportional to its squared distance to the nearest
+already-chosen centroid.
+*/
+func seedCentroidsPlusPlus(points []labPoint, k int) []labCentroid {
+    first := points[rand.Intn(len(points))];
+    centroids := make([]labCentroid, 0, k);
+    centroids = append(centroids, labCentroid{L: first.L, A: first.A, B: first.B});
+
+    for len(centroids) < k {
+        weights := make([]float64, len(points));
+        var total float64;
+        for i, pt := range points {
+            _, d := nearestCentroid(pt, centroids);
+            weighted := d * float64(pt.Weight);
+            weights[i] = weighted;
+            total += weighted;
+        }
+
+        if total == 0 {
+            idx := rand.Intn(len(points));
+            centroids = append(centroids, labCentroid{L: points[idx].L, A: points[idx].A, B: points[idx].B});
+            continue;
+        }
+
+        target := rand.Float64() * total;
+        var cumulative float64;
+        chosen := len(points) - 1;
+        for i, w := range weights {
+            cumulative += w;
+            if cumulative >= target {
+                chosen = i;
+                break;
+            }
+        }
+
+        centroids = append(centroids, labCentroid{L: points[chosen].L, A: points[chosen].A, B: points[chosen].B});
+    }
+
+    return centroids;
+}
+
+/*
+Clusters the given (weighted, unique) colors into k centroids in CIE Lab space using
+Lloyd's algorithm, seeded either uniformly at random or via k-means++.
+
+Arguments:
+    - points ([]labPoint): The unique colors to cluster, weighted by pixel count.
+    - k (int): The number of clusters to produce.
+    - plusPlus (bool): Whether to seed centroids with k-means++ instead of uniform random.
+
+Returns:
+    - []color.Color: The k cluster centroid colors.
+*/
+func kMeansColors(points []labPoint, k int, plusPlus bool) []color.Color {
+    if len(points) == 0 {
+        return nil;
+    }
+    if k > len(points) {
+        k = len(points);
+    }
+
+    var centroids []labCentroid;
+    if plusPlus {
+        centroids = seedCentroidsPlusPlus(points, k);
+    } else {
+        centroids = seedCentroidsRandom(points, k);
+    }
+
+    assignments := make([]int, len(points));
+    for iter := 0; iter < kMeansMaxIterations; iter++ {
+        for i, pt := range points {
+            assignments[i], _ = nearestCentroid(pt, centroids);
+        }
+
+        sums := make([]labCentroid, k);
+        weights := make([]int, k);
+        for i, pt := range points {
+            idx := assignments[i];
+            sums[idx].L += pt.L * float64(pt.Weight);
+            sums[idx].A += pt.A * float64(pt.Weight);
+            sums[idx].B += pt.B * float64(pt.Weight);
+            weights[idx] += pt.Weight;
+        }
+
+        maxChange := 0.0;
+        newCentroids := make([]labCentroid, k);
+        for i := 0; i < k; i++ {
+            if weights[i] == 0 {
+                newCentroids[i] = centroids[i];
+                continue;
+            }
+
+            newCentroids[i] = labCentroid{
+                L: sums[i].L / float64(weights[i]),
+                A: sums[i].A / float64(weights[i]),
+                B: sums[i].B / float64(weights[i]),
+            };
+
+            change := math.Sqrt(
+                math.Pow(newCentroids[i].L-centroids[i].L, 2) +
+                    math.Pow(newCentroids[i].A-centroids[i].A, 2) +
+                    math.Pow(newCentroids[i].B-centroids[i].B, 2),
+            );
+            if change > maxChange {
+                maxChange = change;
+            }
+        }
+
+        centroids = newCentroids;
+        if maxChange < kMeansEpsilon {
+            break;
+        }
+    }
+
+    colors := make([]color.Color, k);
+    for i, c := range centroids {
+        colors[i] = labToColor(c.L, c.A, c.B);
+    }
+    return colors;
+}
+
+/*
+colorBox is a set of Lab-space points being recursively split by median-cut.
+*/
+type colorBox struct {
+    Points []labPoint
+}
+
+/*
+Returns the axis (0=L, 1=a, 2=b) with the widest range in the box, and that range.
+*/
+func longestAxis(box colorBox) (int, float64) {
+    minL, maxL := math.MaxFloat64, -math.MaxFloat64;
+    minA, maxA := math.MaxFloat64, -math.MaxFloat64;
+    minB, maxB := math.MaxFloat64, -math.MaxFloat64;
+
+    for _, pt := range box.Points {
+        minL = math.Min(minL, pt.L);
+        maxL = math.Max(maxL, pt.L);
+        minA = math.Min(minA, pt.A);
+        maxA = math.Max(maxA, pt.A);
+        minB = math.Min(minB, pt.B);
+        maxB = math.Max(maxB, pt.B);
+    }
+
+    rangeL := maxL - minL;
+    rangeA := maxA - minA;
+    rangeB := maxB - minB;
+
+    if rangeL >= rangeA && rangeL >= rangeB {
+        return 0, rangeL;
+    }
+    if rangeA >= rangeB {
+        return 1, rangeA;
+    }
+    return 2, rangeB;
+}
+
+/*
+Finds the splittable box (more than one point) with the widest range, or -1 if none.
+*/
+func widestBoxIndex(boxes []colorBox) int {
+    best := -1;
+    bestRange := 0.0;
+    for i, box := range boxes {
+        if len(box.Points) < 2 {
+            continue;
+        }
+        _, r := longestAxis(box);
+        if r > bestRange || best == -1 {
+            bestRange = r;
+            best = i;
+        }
+    }
+    return best;
+}
+
+/*
+Splits a box along its longest axis at the weighted median, so each half holds
+roughly equal pixel weight.
+*/
+func splitBox(box colorBox) (colorBox, colorBox) {
+    axis, _ := longestAxis(box);
+
+    points := make([]labPoint, len(box.Points));
+    copy(points, box.Points);
+    sort.Slice(points, func(i int, j int) bool {
+        switch axis {
+        case 0:
+            return points[i].L < points[j].L;
+        case 1:
+            return points[i].A < points[j].A;
+        default:
+            return points[i].B < points[j].B;
+        }
+    });
+
+    totalWeight := 0;
+    for _, pt := range points {
+        totalWeight += pt.Weight;
+    }
+
+    half := totalWeight / 2;
+    cumulative := 0;
+    split := len(points) / 2;
+    for i, pt := range points {
+        cumulative += pt.Weight;
+        if cumulative >= half {
+            split = i + 1;
+            break;
+        }
+    }
+
+    if split <= 0 {
+        split = 1;
+    }
+    if split >= len(points) {
+        split = len(points) - 1;
+    }
+
+    return colorBox{Points: points[:split]}, colorBox{Points: points[split:]};
+}
+
+/*
+Averages a box's points (weighted by pixel count) into a single representative color.
+*/
+func averageBoxColor(box colorBox) color.Color {
+    var sumL, sumA, sumB float64;
+    totalWeight := 0;
+    for _, pt := range box.Points {
+        sumL += pt.L * float64(pt.Weight);
+        sumA += pt.A * float64(pt.Weight);
+        sumB += pt.B * float64(pt.Weight);
+        totalWeight += pt.Weight;
+    }
+
+    if totalWeight == 0 {
+        return box.Points[0].Color;
+    }
+
+    return labToColor(sumL/float64(totalWeight), sumA/float64(totalWeight), sumB/float64(totalWeight));
+}
+
+/*
+Extracts k representative colors via median-cut: recursively split the box with the
+widest axis at its weighted median until k boxes exist, then average each box.
+
+Arguments:
+    - points ([]labPoint): The unique colors to extract from, weighted by pixel count.
+    - k (int): The number of colors to produce.
+
+Returns:
+    - []color.Color: Up to k representative colors.
+*/
+func medianCutColors(points []labPoint, k int) []color.Color {
+    if len(points) == 0 {
+        return nil;
+    }
+    if k > len(points) {
+        k = len(points);
+    }
+
+    boxes := []colorBox{{Points: points}};
+    for len(boxes) < k {
+        idx := widestBoxIndex(boxes);
+        if idx < 0 {
+            break;
+        }
+
+        left, right := splitBox(boxes[idx]);
+        boxes = append(boxes[:idx], append([]colorBox{left, right}, boxes[idx+1:]...)...);
+    }
+
+    colors := make([]color.Color, len(boxes));
+    for i, box := range boxes {
+        colors[i] = averageBoxColor(box);
+    }
+    return colors;
+}
+
+/*
+Converts colors to the config file's "#rrggbb" hex string format.
+*/
+func colorsToHex(colors []color.Color) []string {
+    hexList := make([]string, len(colors));
+    for i, c := range colors {
+        hexList[i] = colorToHex(c);
     }
+    return hexList;
+}
 
-    wg.Wait();
-    return result;
+/*
+Converts a color to the config file's "#rrggbb" hex string format.
+*/
+func colorToHex(c color.Color) string {
+    r, g, b, _ := c.RGBA();
+    return fmt.Sprintf("#%02x%02x%02x", r&0xFF, g&0xFF, b&0xFF);
 }
 
 /*
-Saves an image to a path.
+Computes the WCAG relative luminance of a color.
 
 Arguments:
-    - p (string): Path to save image.
-    - i (image.Image): Image to save.
+    - c (color.Color): The color to measure.
 
 Returns:
-    - error: Error saving the image if any.
+    - float64: The relative luminance, in [0, 1].
 
 Example:
-    err := SaveImage("./test.jpeg", i);
-    if err != nil {
-        return err;
+    l := RelativeLuminance(c);
+*/
+func RelativeLuminance(c color.Color) float64 {
+    r, g, b, _ := c.RGBA();
+
+    rl := luminanceChannel(float64(r) / 0xFFFF);
+    gl := luminanceChannel(float64(g) / 0xFFFF);
+    bl := luminanceChannel(float64(b) / 0xFFFF);
+
+    return 0.2126*rl + 0.7152*gl + 0.0722*bl;
+}
+
+/*
+Applies the WCAG linearization step to a single sRGB channel value in [0, 1].
+*/
+func luminanceChannel(c float64) float64 {
+    if c <= 0.03928 {
+        return c / 12.92;
     }
+    return math.Pow((c+0.055)/1.055, 2.4);
+}
+
+/*
+Sorts colors in place by WCAG relative luminance.
+
+Arguments:
+    - colors ([]color.Color): The colors to sort.
+    - ascending (bool): Sorts dark-to-light when true, light-to-dark when false.
 */
-func SaveImage(p string, i image.Image) error {
-    f, err := os.Create(p);
-    if err != nil {
-        return fmt.Errorf("Error: Cannot create file %s. %w", p, err);
+func sortColorsByLuminance(colors []color.Color, ascending bool) {
+    sort.Slice(colors, func(i int, j int) bool {
+        li := RelativeLuminance(colors[i]);
+        lj := RelativeLuminance(colors[j]);
+        if ascending {
+            return li < lj;
+        }
+        return li > lj;
+    });
+}
+
+/*
+Converts a color to HSL (hue in degrees [0, 360), saturation and lightness in [0, 1]).
+*/
+func rgbToHSL(c color.Color) (float64, float64, float64) {
+    r, g, b, _ := c.RGBA();
+    rf := float64(r&0xFF) / 255;
+    gf := float64(g&0xFF) / 255;
+    bf := float64(b&0xFF) / 255;
+
+    max := math.Max(rf, math.Max(gf, bf));
+    min := math.Min(rf, math.Min(gf, bf));
+    l := (max + min) / 2;
+
+    if max == min {
+        return 0, 0, l;
     }
 
-    err = jpeg.Encode(f, i, nil);
-    if err != nil {
-        return fmt.Errorf("Error: Failed to encode image %s. %w", p, err);
+    d := max - min;
+    var s float64;
+    if l > 0.5 {
+        s = d / (2 - max - min);
+    } else {
+        s = d / (max + min);
     }
 
-    return nil;
+    var h float64;
+    switch max {
+    case rf:
+        h = (gf - bf) / d;
+        if gf < bf {
+            h += 6;
+        }
+    case gf:
+        h = (bf-rf)/d + 2;
+    default:
+        h = (rf-gf)/d + 4;
+    }
+    h *= 60;
+
+    return h, s, l;
 }
 
 /*
-Returns a list of colors from the config file.
+Sorts colors in place by HSL hue, ascending.
+*/
+func sortColorsByHue(colors []color.Color) {
+    sort.Slice(colors, func(i int, j int) bool {
+        hi, _, _ := rgbToHSL(colors[i]);
+        hj, _, _ := rgbToHSL(colors[j]);
+        return hi < hj;
+    });
+}
 
-Arguments
-    - p (string): The file path to the config file.
+/*
+ThemeVariant is a background/foreground pair plus a set of accent colors, suitable for
+a terminal/theme config.
+*/
+type ThemeVariant struct {
+    Background string   `json:"background"`
+    Foreground string   `json:"foreground"`
+    Accents    []string `json:"accents"`
+}
+
+/*
+PaletteVariants holds the dark and light theme derived from the same image.
+*/
+type PaletteVariants struct {
+    Dark  ThemeVariant `json:"dark"`
+    Light ThemeVariant `json:"light"`
+}
+
+// PaletteAccentCount is the number of accent hues GeneratePaletteVariants emits,
+// mirroring the 6 non-background/foreground slots of an ANSI-16 palette.
+const PaletteAccentCount = 6
+
+/*
+Generates ANSI-16-style dark and light theme variants from an image: background is the
+darkest color present, foreground the lightest, and up to 6 accents are the centroids
+of k-means clustering in Lab space, ordered by HSL hue. The accent hues are not
+otherwise spread apart.
+
+Arguments:
+    - p ([][]color.Color): The pixels of the image.
 
 Returns:
-    - []color.Color: The list of loaded colors.
-    - error: The error that occured when attempting to load then from the file if any.
+    - PaletteVariants: The dark and light theme variants.
 
 Example:
-    c, err := LoadConfig("./config.json");
-    if err != nil {
-        return err;
-    }
+    v := GeneratePaletteVariants(p);
 */
-func LoadConfig(p string) ([]color.Color, error) {
-    f, err := os.Open(p);
-    if err != nil {
-        return nil, fmt.Errorf("Error: Could not open config file %s. %w", p, err);
+func GeneratePaletteVariants(p [][]color.Color) PaletteVariants {
+    pairs := uniqueColorPairs(p);
+
+    darkest := pairs[0].Key;
+    lightest := pairs[0].Key;
+    darkestLum := RelativeLuminance(darkest);
+    lightestLum := darkestLum;
+    for _, pr := range pairs[1:] {
+        lum := RelativeLuminance(pr.Key);
+        if lum < darkestLum {
+            darkestLum = lum;
+            darkest = pr.Key;
+        }
+        if lum > lightestLum {
+            lightestLum = lum;
+            lightest = pr.Key;
+        }
     }
-    defer f.Close();
 
-    var v ConfigColors;
-    d := json.NewDecoder(f);
-    err = d.Decode(&v);
-    if err != nil {
-        return nil, fmt.Errorf("Error: Could not parse config file %s. %w", p, err);
-    }
+    points := labPointsFromPairs(pairs);
+    accentCount := int(math.Min(float64(len(points)), float64(PaletteAccentCount)));
+    accentColors := kMeansColors(points, accentCount, true);
+    sortColorsByHue(accentColors);
+    accents := colorsToHex(accentColors);
+
+    return PaletteVariants{
+        Dark: ThemeVariant{
+            Background: colorToHex(darkest),
+            Foreground: colorToHex(lightest),
+            Accents:    accents,
+        },
+        Light: ThemeVariant{
+            Background: colorToHex(lightest),
+            Foreground: colorToHex(darkest),
+            Accents:    accents,
+        },
+    };
+}
 
-    result := make([]color.Color, len(v.Colors));
-    for i := 0; i < len(v.Colors); i++ {
-        num, err := strconv.ParseUint(v.Colors[i][1:], 16, 32);
-        if err != nil {
-            return nil, fmt.Errorf("Error: Failed to parse color %s. %w", v.Colors[i], err);
+/*
+Renders PaletteVariants as TOML, with a [dark] and [light] table.
+*/
+func formatPaletteTOML(variants PaletteVariants) string {
+    var sb strings.Builder;
+
+    writeVariant := func(name string, v ThemeVariant) {
+        sb.WriteString(fmt.Sprintf("[%s]\n", name));
+        sb.WriteString(fmt.Sprintf("background = %q\n", v.Background));
+        sb.WriteString(fmt.Sprintf("foreground = %q\n", v.Foreground));
+        sb.WriteString("accents = [");
+        for i, a := range v.Accents {
+            if i > 0 {
+                sb.WriteString(", ");
+            }
+            sb.WriteString(fmt.Sprintf("%q", a));
         }
+        sb.WriteString("]\n\n");
+    };
 
-        result[i] = color.NRGBA{
-            R: uint8(num >> 16),
-            G: uint8((num >> 8) & 0xFF),
-            B: uint8(num & 0xFF),
-            A: uint8(0xFF),
-        };
+    writeVariant("dark", variants.Dark);
+    writeVariant("light", variants.Light);
+
+    return sb.String();
+}
+
+/*
+Renders a single ThemeVariant as pywal-compatible JSON (a "special" block plus a flat
+"colors" map of color0-color15).
+*/
+func formatPywalJSON(v ThemeVariant) (string, error) {
+    type pywalSpecial struct {
+        Background string `json:"background"`
+        Foreground string `json:"foreground"`
+        Cursor     string `json:"cursor"`
+    }
+    type pywalOutput struct {
+        Special pywalSpecial      `json:"special"`
+        Colors  map[string]string `json:"colors"`
     }
 
-    return result, nil;
+    colors := make(map[string]string, 16);
+    colors["color0"] = v.Background;
+    colors["color7"] = v.Foreground;
+    colors["color8"] = v.Background;
+    colors["color15"] = v.Foreground;
+    for i, accent := range v.Accents {
+        if i >= PaletteAccentCount {
+            break;
+        }
+        colors[fmt.Sprintf("color%d", i+1)] = accent;
+        colors[fmt.Sprintf("color%d", i+9)] = accent;
+    }
+
+    out := pywalOutput{
+        Special: pywalSpecial{Background: v.Background, Foreground: v.Foreground, Cursor: v.Foreground},
+        Colors:  colors,
+    };
+
+    b, err := json.MarshalIndent(out, "", "  ");
+    if err != nil {
+        return "", fmt.Errorf("Error: Failed to marshal pywal JSON. %w", err);
+    }
+    return string(b), nil;
 }
 
 /*
-Save a color scheme to a file.
+Saves PaletteVariants to a file in the given format.
 
 Arguments:
-    - p (string): The path to save the color scheme to.
-    - c (SaveConfg): The color theme.
+    - p (string): The path to save the theme to.
+    - variants (PaletteVariants): The theme to save.
+    - format (string): One of "json" (default), "toml" or "pywal".
+    - variantName (string): For "pywal" only, which variant to export: "dark" or "light".
 
 Returns:
     - error: An error if any occured.
 
 Example:
-    err := SaveConfg("./theme.json", c);
+    err := SavePaletteVariants("./theme.json", v, "json", "dark");
     if err != nil {
         return err;
     }
 */
-func SaveConfg(p string, c ConfigColors) error {
+func SavePaletteVariants(p string, variants PaletteVariants, format string, variantName string) error {
     f, err := os.Create(p);
     if err != nil {
         return fmt.Errorf("Error: Failed to create file %s. %w", p, err);
     }
     defer f.Close();
 
-    e := json.NewEncoder(f);
-    err = e.Encode(c);
-    if err != nil {
-        return fmt.Errorf("Error: Failed to write JSON to %s. %w", p, err);
+    switch format {
+    case "toml":
+        _, err = f.WriteString(formatPaletteTOML(variants));
+        if err != nil {
+            return fmt.Errorf("Error: Failed to write TOML to %s. %w", p, err);
+        }
+    case "pywal":
+        variant := variants.Dark;
+        if variantName == "light" {
+            variant = variants.Light;
+        }
+
+        out, err := formatPywalJSON(variant);
+        if err != nil {
+            return err;
+        }
+
+        _, err = f.WriteString(out);
+        if err != nil {
+            return fmt.Errorf("Error: Failed to write pywal JSON to %s. %w", p, err);
+        }
+    default:
+        b, err := json.MarshalIndent(variants, "", "  ");
+        if err != nil {
+            return fmt.Errorf("Error: Failed to marshal theme JSON. %w", err);
+        }
+
+        _, err = f.Write(b);
+        if err != nil {
+            return fmt.Errorf("Error: Failed to write JSON to %s. %w", p, err);
+        }
     }
 
     return nil;
@@ -337,7 +2521,9 @@ Generates a color scheme from an image based on most used colors.
 
 Arguments:
     - p ([][]color.Color): The pixels of the image.
-    - m (string): The method to sort by when generating color scheme.
+    - m (string): The method to generate the color scheme with: "min"/"max" sort by
+      frequency, "kmeans"/"kmeans++" cluster in Lab space, and "median-cut" recursively
+      splits the color box along its longest axis.
 
 Returns:
     - ConfigColors: The colors for the color theme.
@@ -346,18 +2532,32 @@ Example:
     c := GenerateColors(p, "min");
 */
 func GenerateColors(p [][]color.Color, m string) ConfigColors {
-    colorCache := make(map[color.Color]int);
-    for i := 0; i < len(p); i++ {
-        for j := 0; j < len(p[i]); j++ {
-            colorCache[p[i][j]] += 1;
-        }
+    colorPairs := uniqueColorPairs(p);
+    size := int(math.Min(float64(len(colorPairs)), float64(PaletteSize)));
+
+    if m == "kmeans" || m == "kmeans++" {
+        points := labPointsFromPairs(colorPairs);
+        return ConfigColors{Colors: colorsToHex(kMeansColors(points, size, m == "kmeans++"))};
     }
 
-    colorPairs := make(ColorPairList, len(colorCache));
-    i := 0;
-    for k, v := range colorCache {
-        colorPairs[i] = ColorPair{Key: k, Value: v};
-        i++; 
+    if m == "median-cut" {
+        points := labPointsFromPairs(colorPairs);
+        return ConfigColors{Colors: colorsToHex(medianCutColors(points, size))};
+    }
+
+    if m == "luminance-asc" || m == "luminance-desc" {
+        sort.Sort(sort.Reverse(colorPairs));
+        colors := make([]color.Color, size);
+        for i := 0; i < size; i++ {
+            colors[i] = colorPairs[i].Key;
+        }
+        sortColorsByLuminance(colors, m == "luminance-asc");
+
+        luminances := make([]float64, size);
+        for i := 0; i < size; i++ {
+            luminances[i] = RelativeLuminance(colors[i]);
+        }
+        return ConfigColors{Colors: colorsToHex(colors), Luminance: luminances};
     }
 
     if m == "min" {
@@ -366,7 +2566,6 @@ func GenerateColors(p [][]color.Color, m string) ConfigColors {
         sort.Sort(sort.Reverse(colorPairs));
     }
 
-    size := int(math.Min(float64(len(colorPairs)), 21.0))
     colors := make([]string, size);
     for i := 0; i < size; i++ {
         r, g, b, _ := colorPairs[i].Key.RGBA();
@@ -379,41 +2578,286 @@ func GenerateColors(p [][]color.Color, m string) ConfigColors {
     };
 }
 
+/*
+Builds a ColorPairList of each unique color in an image's pixels and how many times
+it occurs.
+
+Arguments:
+    - p ([][]color.Color): The pixels of the image.
+
+Returns:
+    - ColorPairList: The unique colors, each paired with its pixel count.
+*/
+func uniqueColorPairs(p [][]color.Color) ColorPairList {
+    colorCache := make(map[color.Color]int);
+    for i := 0; i < len(p); i++ {
+        for j := 0; j < len(p[i]); j++ {
+            colorCache[p[i][j]] += 1;
+        }
+    }
+
+    pairs := make(ColorPairList, len(colorCache));
+    i := 0;
+    for k, v := range colorCache {
+        pairs[i] = ColorPair{Key: k, Value: v};
+        i++;
+    }
+    return pairs;
+}
+
+/*
+Parses the optional trailing "convert" CLI arguments into ConvertOptions: an optional
+metric name ("srgb", "luma" or "lab") and an optional "dither" flag, in either order.
+
+Arguments:
+    - args ([]string): The trailing arguments after the save path.
+
+Returns:
+    - ConvertOptions: The parsed options.
+*/
+func parseConvertOptions(args []string) ConvertOptions {
+    opts := DefaultConvertOptions();
+
+    for _, arg := range args {
+        switch arg {
+        case "srgb":
+            opts.Metric = SRGBEuclideanMetric{};
+        case "luma":
+            opts.Metric = LumaWeightedMetric{};
+        case "lab":
+            opts.Metric = CIELabMetric{};
+        case "dither":
+            opts.Dither = true;
+        }
+    }
+
+    return opts;
+}
+
+/*
+Parses a "WxH" dimension string.
+
+Arguments:
+    - s (string): The dimension string, e.g. "1920x1080".
+
+Returns:
+    - int: The parsed width.
+    - int: The parsed height.
+    - error: An error if the string is not a valid "WxH" pair.
+*/
+func parseDimensions(s string) (int, int, error) {
+    parts := strings.SplitN(s, "x", 2);
+    if len(parts) != 2 {
+        return 0, 0, fmt.Errorf("Error: Invalid resize dimensions %s. Expected format WxH.", s);
+    }
+
+    w, err := strconv.Atoi(parts[0]);
+    if err != nil {
+        return 0, 0, fmt.Errorf("Error: Invalid resize width %s. %w", parts[0], err);
+    }
+
+    h, err := strconv.Atoi(parts[1]);
+    if err != nil {
+        return 0, 0, fmt.Errorf("Error: Invalid resize height %s. %w", parts[1], err);
+    }
+
+    return w, h, nil;
+}
+
+/*
+Scans CLI args for a "--resize WxH" pair, removing it and returning the corresponding
+ResizeOptions (Fit "contain", Kernel "bilinear") along with the remaining positional args.
+
+Arguments:
+    - args ([]string): The CLI arguments, excluding the program name.
+
+Returns:
+    - []string: The remaining positional args, with any "--resize WxH" pair removed.
+    - ResizeOptions: The parsed resize options. MaxWidth/MaxHeight are 0 if not given.
+*/
+func extractResizeFlag(args []string) ([]string, ResizeOptions) {
+    cleaned := make([]string, 0, len(args));
+    opts := ResizeOptions{Fit: "contain", Kernel: "bilinear"};
+
+    for i := 0; i < len(args); i++ {
+        if args[i] == "--resize" && i+1 < len(args) {
+            w, h, err := parseDimensions(args[i+1]);
+            if err != nil {
+                fmt.Fprintf(os.Stderr, "Error: %v\n", err);
+            } else {
+                opts.MaxWidth = w;
+                opts.MaxHeight = h;
+            }
+            i++;
+            continue;
+        }
+        cleaned = append(cleaned, args[i]);
+    }
+
+    return cleaned, opts;
+}
+
+/*
+Scans CLI args for a "<name> <int>" pair, removing it and returning the parsed value
+(or def if not present) along with the remaining positional args.
+
+Arguments:
+    - args ([]string): The CLI arguments to scan.
+    - name (string): The flag name, e.g. "--tile".
+    - def (int): The value to return if the flag is absent.
+
+Returns:
+    - []string: The remaining positional args, with any "<name> <int>" pair removed.
+    - int: The parsed value, or def if the flag was absent or invalid.
+*/
+func extractIntFlag(args []string, name string, def int) ([]string, int) {
+    cleaned := make([]string, 0, len(args));
+    value := def;
+
+    for i := 0; i < len(args); i++ {
+        if args[i] == name && i+1 < len(args) {
+            v, err := strconv.Atoi(args[i+1]);
+            if err != nil {
+                fmt.Fprintf(os.Stderr, "Error: Invalid value for %s: %s\n", name, args[i+1]);
+            } else {
+                value = v;
+            }
+            i++;
+            continue;
+        }
+        cleaned = append(cleaned, args[i]);
+    }
+
+    return cleaned, value;
+}
+
+/*
+Scans CLI args for a bare flag (e.g. "--pal-json"), removing it and reporting whether
+it was present.
+
+Arguments:
+    - args ([]string): The CLI arguments to scan.
+    - name (string): The flag name.
+
+Returns:
+    - []string: The remaining positional args, with any occurrence of name removed.
+    - bool: Whether the flag was present.
+*/
+func extractBoolFlag(args []string, name string) ([]string, bool) {
+    cleaned := make([]string, 0, len(args));
+    found := false;
+
+    for _, arg := range args {
+        if arg == name {
+            found = true;
+            continue;
+        }
+        cleaned = append(cleaned, arg);
+    }
+
+    return cleaned, found;
+}
+
 func main() {
-    if len(os.Args) < 5 {
-        fmt.Fprintf(os.Stderr, "Usage: gowall <convert|generate> <config path> <image path> [save path|min|max]\n");
+    args, resizeOpts := extractResizeFlag(os.Args[1:]);
+    args, tileSize := extractIntFlag(args, "--tile", 0);
+    args, workers := extractIntFlag(args, "--workers", 1);
+    args, quality := extractIntFlag(args, "--quality", 90);
+    args, emitPalJSON := extractBoolFlag(args, "--pal-json");
+
+    if len(args) < 4 {
+        fmt.Fprintf(os.Stderr, "Usage: gowall <convert|generate> <config path> <image path> [save path|min|max] [srgb|luma|lab] [dither] [--resize WxH] [--tile N --workers M] [--quality N] [--pal-json]\n");
+        fmt.Fprintf(os.Stderr, "       gowall theme <image path> <save path> <json|toml|pywal> [dark|light] [--resize WxH]\n");
         return;
     }
 
-    if os.Args[1] == "convert" {
-        c, err := LoadConfig(os.Args[2]);
+    if args[0] == "theme" {
+        i, err := LoadImage(args[1]);
+        if err != nil {
+            fmt.Fprintf(os.Stderr, "Error: Failed to load image. %v\n", err);
+            return;
+        }
+
+        if resizeOpts.MaxWidth > 0 && resizeOpts.MaxHeight > 0 {
+            i = ResizeImage(i, resizeOpts);
+        }
+
+        variantName := "dark";
+        if len(args) > 4 {
+            variantName = args[4];
+        }
+
+        p := LoadPixels(i);
+        variants := GeneratePaletteVariants(p);
+        err = SavePaletteVariants(args[2], variants, args[3], variantName);
+        if err != nil {
+            fmt.Fprintf(os.Stderr, "Error: Failed to save theme. %v\n", err);
+        }
+    } else if args[0] == "convert" {
+        c, err := LoadConfig(args[1]);
         if err != nil {
             fmt.Fprintf(os.Stderr, "Error: Failed to load config. %v\n", err);
             return;
         }
 
-        i, err := LoadImage(os.Args[3]);
+        i, err := LoadImage(args[2]);
         if err != nil {
             fmt.Fprintf(os.Stderr, "Error: Failed to load image. %v\n", err);
             return;
         }
 
-        p := LoadPixels(i);
-        r := ConvertImage(p, c);
-        err = SaveImage(os.Args[4], r);
+        if resizeOpts.MaxWidth > 0 && resizeOpts.MaxHeight > 0 {
+            i = ResizeImage(i, resizeOpts);
+        }
+
+        convertOpts := parseConvertOptions(args[4:]);
+
+        var r image.Image;
+        if tileSize > 0 {
+            if convertOpts.Dither {
+                fmt.Fprintf(os.Stderr, "Note: dithering requires a serial whole-image pass; ignoring --tile/--workers for this conversion.\n");
+            }
+            conv := NewConverter(c, convertOpts);
+            conv.Workers = workers;
+            conv.Progress = func(done int, total int) {
+                fmt.Fprintf(os.Stderr, "\rConverting... %d/%d tiles", done, total);
+            };
+            r = conv.Convert(i, tileSize);
+            fmt.Fprintf(os.Stderr, "\n");
+        } else {
+            p := LoadPixels(i);
+            r = ConvertImage(p, c, convertOpts);
+        }
+
+        saveOpts := DefaultSaveOptions();
+        saveOpts.Quality = quality;
+        saveOpts.Palette = c;
+
+        err = SaveImage(args[3], r, saveOpts);
         if err != nil {
             fmt.Fprintf(os.Stderr, "Error: Failed to save image. %v\n", err);
         }
-    } else if os.Args[1] == "generate" {
-        i, err := LoadImage(os.Args[3]);
+
+        if emitPalJSON {
+            err = SavePaletteAlongside(args[3], c);
+            if err != nil {
+                fmt.Fprintf(os.Stderr, "Error: Failed to save palette. %v\n", err);
+            }
+        }
+    } else if args[0] == "generate" {
+        i, err := LoadImage(args[2]);
         if err != nil {
             fmt.Fprintf(os.Stderr, "Error: Failed to load image. %v\n", err);
             return;
         }
 
+        if resizeOpts.MaxWidth > 0 && resizeOpts.MaxHeight > 0 {
+            i = ResizeImage(i, resizeOpts);
+        }
+
         p := LoadPixels(i);
-        c := GenerateColors(p, os.Args[4]);
-        err = SaveConfg(os.Args[2], c);
+        c := GenerateColors(p, args[3]);
+        err = SaveConfg(args[1], c);
         if err != nil {
             fmt.Fprintf(os.Stderr, "Error: Failed to save color scheme. %v\n", err);
         }
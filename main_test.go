@@ -0,0 +1,244 @@
+package main;
+
+import (
+    "bytes";
+    "image";
+    "image/color";
+    "math";
+    "testing";
+)
+
+/*
+colorToLab/labToColor should round-trip sRGB colors back to themselves (within a few
+units of rounding error) for both neutral and saturated colors.
+*/
+func TestColorToLabRoundTrip(t *testing.T) {
+    cases := []color.NRGBA{
+        {R: 0, G: 0, B: 0, A: 0xFF},
+        {R: 0xFF, G: 0xFF, B: 0xFF, A: 0xFF},
+        {R: 128, G: 64, B: 200, A: 0xFF},
+        {R: 0xFF, G: 0, B: 0, A: 0xFF},
+        {R: 10, G: 200, B: 90, A: 0xFF},
+    };
+
+    for _, c := range cases {
+        l, a, b := colorToLab(c);
+        got := labToColor(l, a, b).(color.NRGBA);
+
+        if absInt(int(got.R)-int(c.R)) > 1 || absInt(int(got.G)-int(c.G)) > 1 || absInt(int(got.B)-int(c.B)) > 1 {
+            t.Errorf("colorToLab/labToColor round trip for %+v got %+v", c, got);
+        }
+    }
+}
+
+/*
+Dithered conversion should match every output pixel to an entry already present in the
+palette, even though error-diffusion computes those matches very differently from a
+direct nearest-color lookup.
+*/
+func TestConvertImageDitherMatchesPalette(t *testing.T) {
+    img := benchmarkImage(32);
+    palette := benchmarkPalette();
+    paletteSet := make(map[color.Color]bool, len(palette));
+    for _, c := range palette {
+        paletteSet[color.NRGBAModel.Convert(c)] = true;
+    }
+
+    opts := DefaultConvertOptions();
+    opts.Dither = true;
+    dithered := ConvertImage(LoadPixels(img), palette, opts);
+
+    bounds := dithered.Bounds();
+    for y := 0; y < bounds.Dy(); y++ {
+        for x := 0; x < bounds.Dx(); x++ {
+            px := color.NRGBAModel.Convert(dithered.At(x, y));
+            if !paletteSet[px] {
+                t.Fatalf("dithered pixel (%d,%d) = %+v is not in the palette", x, y, px);
+            }
+        }
+    }
+}
+
+/*
+Builds a synthetic size x size gradient image for benchmarking, so results don't depend
+on a fixture file being present on disk.
+*/
+func benchmarkImage(size int) image.Image {
+    img := image.NewNRGBA(image.Rect(0, 0, size, size));
+    for y := 0; y < size; y++ {
+        for x := 0; x < size; x++ {
+            img.Set(x, y, color.NRGBA{R: uint8(x), G: uint8(y), B: uint8(x + y), A: 0xFF});
+        }
+    }
+    return img;
+}
+
+func benchmarkPalette() []color.Color {
+    return []color.Color{
+        color.NRGBA{R: 0, G: 0, B: 0, A: 0xFF},
+        color.NRGBA{R: 0xFF, G: 0xFF, B: 0xFF, A: 0xFF},
+        color.NRGBA{R: 0xFF, G: 0, B: 0, A: 0xFF},
+        color.NRGBA{R: 0, G: 0xFF, B: 0, A: 0xFF},
+        color.NRGBA{R: 0, G: 0, B: 0xFF, A: 0xFF},
+    };
+}
+
+/*
+Benchmarks the original in-memory, fully-buffered conversion path.
+*/
+func BenchmarkConvertImage(b *testing.B) {
+    img := benchmarkImage(512);
+    palette := benchmarkPalette();
+    p := LoadPixels(img);
+    opts := DefaultConvertOptions();
+
+    b.ResetTimer();
+    for n := 0; n < b.N; n++ {
+        ConvertImage(p, palette, opts);
+    }
+}
+
+/*
+Benchmarks the tiled/streaming Converter added for low-memory environments, with
+64x64 tiles and 4 workers.
+*/
+func BenchmarkConverterTiled(b *testing.B) {
+    img := benchmarkImage(512);
+    palette := benchmarkPalette();
+    opts := DefaultConvertOptions();
+
+    b.ResetTimer();
+    for n := 0; n < b.N; n++ {
+        conv := NewConverter(palette, opts);
+        conv.Workers = 4;
+        conv.Convert(img, 64);
+    }
+}
+
+/*
+RelativeLuminance should match the WCAG formula's reference points: 0 for black and 1
+for white.
+*/
+func TestRelativeLuminance(t *testing.T) {
+    black := RelativeLuminance(color.NRGBA{R: 0, G: 0, B: 0, A: 0xFF});
+    white := RelativeLuminance(color.NRGBA{R: 0xFF, G: 0xFF, B: 0xFF, A: 0xFF});
+
+    if black != 0 {
+        t.Errorf("RelativeLuminance(black) = %v, want 0", black);
+    }
+    if math.Abs(white-1) > 1e-9 {
+        t.Errorf("RelativeLuminance(white) = %v, want 1", white);
+    }
+    if black >= white {
+        t.Errorf("RelativeLuminance(black) should be less than RelativeLuminance(white)");
+    }
+}
+
+func absInt(v int) int {
+    if v < 0 {
+        return -v;
+    }
+    return v;
+}
+
+/*
+bmpEncode/bmpDecode should round-trip an opaque image exactly: both are uncompressed,
+24-bit-per-pixel RGB with no lossy step.
+*/
+func TestBMPRoundTrip(t *testing.T) {
+    src := benchmarkImage(17);
+
+    var buf bytes.Buffer;
+    if err := bmpEncode(&buf, src); err != nil {
+        t.Fatalf("bmpEncode failed: %v", err);
+    }
+
+    decoded, err := bmpDecode(&buf);
+    if err != nil {
+        t.Fatalf("bmpDecode failed: %v", err);
+    }
+
+    assertImagesEqualRGB(t, src, decoded);
+}
+
+/*
+tiffEncode/tiffDecode should round-trip an opaque image exactly: both are uncompressed,
+single-strip, 8-bit-per-sample RGB with no lossy step.
+*/
+func TestTIFFRoundTrip(t *testing.T) {
+    src := benchmarkImage(17);
+
+    var buf bytes.Buffer;
+    if err := tiffEncode(&buf, src); err != nil {
+        t.Fatalf("tiffEncode failed: %v", err);
+    }
+
+    decoded, err := tiffDecode(&buf);
+    if err != nil {
+        t.Fatalf("tiffDecode failed: %v", err);
+    }
+
+    assertImagesEqualRGB(t, src, decoded);
+}
+
+/*
+Fails the test if two images differ in bounds or in any pixel's RGB channels.
+*/
+func assertImagesEqualRGB(t *testing.T, want image.Image, got image.Image) {
+    t.Helper();
+
+    wb := want.Bounds();
+    gb := got.Bounds();
+    if wb.Dx() != gb.Dx() || wb.Dy() != gb.Dy() {
+        t.Fatalf("size mismatch: want %dx%d, got %dx%d", wb.Dx(), wb.Dy(), gb.Dx(), gb.Dy());
+    }
+
+    for y := 0; y < wb.Dy(); y++ {
+        for x := 0; x < wb.Dx(); x++ {
+            wr, wg, wbch, _ := want.At(wb.Min.X+x, wb.Min.Y+y).RGBA();
+            gr, gg, gbch, _ := got.At(gb.Min.X+x, gb.Min.Y+y).RGBA();
+            if wr != gr || wg != gg || wbch != gbch {
+                t.Fatalf("pixel (%d,%d) mismatch: want rgb(%d,%d,%d), got rgb(%d,%d,%d)", x, y, wr>>8, wg>>8, wbch>>8, gr>>8, gg>>8, gbch>>8);
+            }
+        }
+    }
+}
+
+/*
+ResizeImage with Fit "cover" must always return exactly MaxWidth x MaxHeight, cropping
+any overflow left over from the cover-scale rather than returning the larger,
+uncropped dimension.
+*/
+func TestResizeImageCoverFit(t *testing.T) {
+    src := benchmarkImage(1000);
+    r := ResizeImage(src, ResizeOptions{MaxWidth: 200, MaxHeight: 100, Fit: "cover"});
+
+    bounds := r.Bounds();
+    if bounds.Dx() != 200 || bounds.Dy() != 100 {
+        t.Errorf("cover fit: got %dx%d, want 200x100", bounds.Dx(), bounds.Dy());
+    }
+}
+
+/*
+ResizeImage must not darken partially-transparent pixels toward black: resampling
+reads premultiplied RGBA from img.At, so the result has to be unpremultiplied before
+being written back into straight-alpha output.
+*/
+func TestResizeImagePreservesColorUnderAlpha(t *testing.T) {
+    src := image.NewNRGBA(image.Rect(0, 0, 4, 4));
+    for y := 0; y < 4; y++ {
+        for x := 0; x < 4; x++ {
+            src.SetNRGBA(x, y, color.NRGBA{R: 200, G: 100, B: 50, A: 128});
+        }
+    }
+
+    r := ResizeImage(src, ResizeOptions{MaxWidth: 2, MaxHeight: 2, Fit: "stretch", Kernel: "bilinear"});
+    got := color.NRGBAModel.Convert(r.At(0, 0)).(color.NRGBA);
+
+    if absInt(int(got.R)-200) > 2 || absInt(int(got.G)-100) > 2 || absInt(int(got.B)-50) > 2 {
+        t.Errorf("resize with alpha: got %+v, want ~{R:200 G:100 B:50 A:128}", got);
+    }
+    if absInt(int(got.A)-128) > 2 {
+        t.Errorf("resize with alpha: alpha got %d, want ~128", got.A);
+    }
+}